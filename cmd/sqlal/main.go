@@ -1,21 +1,22 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
-	"strings"
+	"text/tabwriter"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/robfig/cron/v3"
 
 	"github.com/yendefrr/sql-alerts/internal"
 )
@@ -27,11 +28,20 @@ const (
 	defaultConfigDir      = ".config/sqlal"
 )
 
+const (
+	// Due retries are looked for this often when no query queues new notifications
+	outboxPollInterval = 5 * time.Second
+	deliveryTimeout    = time.Minute
+)
+
 var (
 	configFile  string
 	flagVersion bool
 )
 
+// deliveryWake tells the delivery loop that new notifications are queued
+var deliveryWake = make(chan struct{}, 1)
+
 func main() {
 	if err := initializeDirectories(); err != nil {
 		log.Fatalf("Failed to initialize directories: %v", err)
@@ -68,6 +78,12 @@ func main() {
 		case "config":
 			config()
 			return
+		case "deadletters":
+			deadLetters(os.Args[2:])
+			return
+		case "maintenance":
+			maintenance(os.Args[2:])
+			return
 		}
 	}
 
@@ -76,14 +92,15 @@ func main() {
 		log.Fatal(err)
 	}
 
-	processedDir := createProcessedDir()
+	store := openStateStore()
+	defer store.Close()
 
-	db := connectToDatabase(config)
-	defer db.Close()
+	dbs := connectToDatabases(config)
+	defer closeDatabases(dbs)
 
 	sendInitialNotification(config)
 
-	runMonitoringLoop(db, config, processedDir)
+	runMonitoringLoop(dbs, config, store)
 }
 
 func printVersion() {
@@ -91,48 +108,164 @@ func printVersion() {
 	os.Exit(0)
 }
 
-func createProcessedDir() string {
-	processedDir := filepath.Join(getUserConfigDir(), "processed")
-	if err := os.MkdirAll(processedDir, 0755); err != nil {
-		log.Fatalf("Failed to create processed directory: %v", err)
+func openStateStore() *internal.StateStore {
+	store, err := internal.OpenStateStore(filepath.Join(getUserConfigDir(), "state.db"))
+	if err != nil {
+		log.Fatalf("Failed to open state store: %v", err)
 	}
-	return processedDir
-}
 
-func connectToDatabase(config internal.Config) *sql.DB {
-	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", config.Database.Username, config.Database.Password, config.Database.Host, config.Database.Port, config.Database.Name))
+	// Older versions kept processed IDs in text files, import them once
+	imported, err := store.ImportProcessedDir(filepath.Join(getUserConfigDir(), "processed"))
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Failed to import processed files: %v", err)
+	}
+	if imported > 0 {
+		log.Printf("Imported %d processed files into state store", imported)
 	}
-	log.Println("Connection with database established")
-	return db
+	return store
 }
 
+func connectToDatabases(config internal.Config) map[string]*sql.DB {
+	dbs := make(map[string]*sql.DB, len(config.Databases))
+	for _, name := range config.GetDatabaseNames() {
+		db, err := internal.OpenDatabase(config.Databases[name])
+		if err != nil {
+			log.Fatalf("Database %s: %v", name, err)
+		}
+		dbs[name] = db
+		log.Printf("Connection with database %s established", name)
+	}
+	return dbs
+}
+
+func closeDatabases(dbs map[string]*sql.DB) {
+	for _, db := range dbs {
+		db.Close()
+	}
+}
+
+// sendInitialNotification tells baseNotificationUrl that monitoring started. It is only
+// a courtesy, so a failure is logged and monitoring goes on.
 func sendInitialNotification(config internal.Config) {
-	payload := strings.NewReader("Monitoring server started")
-	resp, err := http.Post(config.BaseNotificationURL, "text/plain", payload)
+	if config.BaseNotificationURL == "" {
+		return
+	}
+
+	notifier, err := internal.NewNotifier(&config, internal.QueryConfig{Name: "sqlal"})
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("Warning: initial notification not sent: %v", err)
+		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("HTTP request failed with status code: %d", resp.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+	err = notifier.Notify(ctx, internal.Notification{Query: "sqlal", Message: "Monitoring server started", Time: time.Now()})
+	if err != nil {
+		log.Printf("Warning: initial notification not sent: %v", err)
+		return
 	}
 	log.Print("Initial notification sent")
 }
 
-func runMonitoringLoop(db *sql.DB, config internal.Config, processedDir string) {
-	for {
-		for _, queryConfig := range config.Queries {
-			if !queryConfig.Disabled {
-				err := monitorAndNotify(db, config, queryConfig, processedDir)
-				if err != nil {
-					log.Printf("Error during monitoring: %v", err)
-				}
-			}
+// runMonitoringLoop schedules every enabled query on its own interval or cron expression.
+// At most config.Workers queries run at once, a query is skipped while its previous run
+// is still in progress or waiting for a free worker.
+func runMonitoringLoop(dbs map[string]*sql.DB, config internal.Config, store *internal.StateStore) {
+	logger := cron.PrintfLogger(log.Default())
+	scheduler := cron.New(cron.WithLogger(logger))
+	workers := make(chan struct{}, config.WorkerCount())
+
+	for _, queryConfig := range config.Queries {
+		if queryConfig.Disabled {
+			continue
+		}
+
+		if _, err := config.QueryDatabase(queryConfig); err != nil {
+			log.Fatal(err)
+		}
+		schedule, err := config.QuerySchedule(queryConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		timeout, err := config.QueryTimeout(queryConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := config.QueryThrottle(queryConfig); err != nil {
+			log.Fatal(err)
+		}
+		if _, err := config.QuerySuppression(queryConfig, nil, time.Now()); err != nil {
+			log.Fatal(err)
 		}
-		time.Sleep(time.Duration(config.CheckIntervalSeconds) * time.Second)
+		if err := config.CheckQueryTargets(queryConfig); err != nil {
+			log.Fatal(err)
+		}
+
+		queryConfig := queryConfig
+		job := cron.NewChain(cron.SkipIfStillRunning(logger)).Then(cron.FuncJob(func() {
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			runQuery(dbs, config, queryConfig, store, timeout)
+		}))
+		scheduler.Schedule(schedule, job)
+
+		// Interval queries are checked right away, cron ones wait for their time
+		if queryConfig.Cron == "" {
+			go job.Run()
+		}
+	}
+
+	for name, target := range config.Targets {
+		if target.RateLimit == nil {
+			continue
+		}
+		if _, err := target.RateLimit.Parse(); err != nil {
+			log.Fatalf("target %s: %v", name, err)
+		}
+	}
+
+	scheduler.Schedule(cron.Every(time.Hour), cron.FuncJob(func() {
+		pruneState(config, store)
+	}))
+
+	go runDelivery(config, store)
+
+	scheduler.Run()
+}
+
+func runQuery(dbs map[string]*sql.DB, config internal.Config, queryConfig internal.QueryConfig, store *internal.StateStore, timeout time.Duration) {
+	dbName, err := config.QueryDatabase(queryConfig)
+	if err != nil {
+		log.Printf("Error during monitoring: %v", err)
+		return
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err = monitorAndNotify(ctx, dbs[dbName], config, queryConfig, store)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = &queryTimeoutError{query: queryConfig.Name, timeout: timeout}
+	}
+
+	var timeoutErr *queryTimeoutError
+	if errors.As(err, &timeoutErr) {
+		log.Printf("Timeout during monitoring: %v", err)
+	} else if err != nil {
+		log.Printf("Error during monitoring %s: %v", queryConfig.Name, err)
+	} else {
+		wakeDelivery()
+	}
+}
+
+type queryTimeoutError struct {
+	query   string
+	timeout time.Duration
+}
+
+func (e *queryTimeoutError) Error() string {
+	return fmt.Sprintf("query %s did not finish in %s", e.query, e.timeout)
 }
 
 func initializeDirectories() error {
@@ -146,11 +279,6 @@ func initializeDirectories() error {
 		return err
 	}
 
-	processedDir := filepath.Join(configDir, "processed")
-	if err := os.MkdirAll(processedDir, 0755); err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -166,77 +294,665 @@ func getUserConfigDir() string {
 	return filepath.Join(homeDir, defaultConfigDir)
 }
 
-func monitorAndNotify(db *sql.DB, config internal.Config, queryConfig internal.QueryConfig, processedDir string) error {
-	processedIDs, err := readProcessedIDs(queryConfig.Name, processedDir)
+func monitorAndNotify(ctx context.Context, db *sql.DB, config internal.Config, queryConfig internal.QueryConfig, store *internal.StateStore) error {
+	switch queryConfig.Type {
+	case "", internal.QueryTypeNewRows:
+	case internal.QueryTypeThreshold:
+		return monitorThresholdAndNotify(ctx, db, config, queryConfig, store)
+	case internal.QueryTypeAbsence:
+		return monitorAbsenceAndNotify(ctx, db, config, queryConfig, store)
+	case internal.QueryTypeDiff:
+		return monitorDiffAndNotify(ctx, db, config, queryConfig, store)
+	default:
+		return fmt.Errorf("unknown type %q of query %s", queryConfig.Type, queryConfig.Name)
+	}
+
+	columns, newRows, commit, err := fetchNewRows(ctx, db, config, queryConfig, store)
 	if err != nil {
 		return err
 	}
 
-	newRows, err := getNewRows(db, queryConfig.Query, processedIDs)
+	if len(newRows) == 0 {
+		// Nothing to notify, but keys still in the result may need their seen time refreshed
+		if commit == nil {
+			return nil
+		}
+		return store.Update(commit)
+	}
+
+	notification, err := rowsNotification(config, queryConfig, columns, newRows)
 	if err != nil {
 		return err
 	}
+	return store.Update(func(tx *internal.StateTx) error {
+		if err := enqueueNotifications(tx, config, queryConfig, notification); err != nil {
+			return err
+		}
+		return commit(tx)
+	})
+}
 
-	if len(newRows) > 0 {
-		err := sendNotifications(config, queryConfig, newRows)
+// fetchNewRows returns rows not seen before, either by processed IDs or by cursor.
+// The returned commit remembers them in the transaction which queues their notifications,
+// it is nil when there is nothing to remember.
+func fetchNewRows(ctx context.Context, db *sql.DB, config internal.Config, queryConfig internal.QueryConfig, store *internal.StateStore) ([]string, []internal.Row, func(tx *internal.StateTx) error, error) {
+	if queryConfig.Cursor != "" {
+		cursor, err := readCursor(queryConfig, store)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		columns, newRows, next, err := getRowsAfterCursor(ctx, db, queryConfig, cursor)
+		if err != nil || len(newRows) == 0 {
+			return columns, nil, nil, err
+		}
+		return columns, newRows, func(tx *internal.StateTx) error {
+			return writeCursor(tx, queryConfig, next)
+		}, nil
+	}
+
+	columns, newRows, keys, err := getNewRows(ctx, db, queryConfig, store, refreshSeenBefore(config))
+	if err != nil || len(keys) == 0 {
+		return columns, nil, nil, err
+	}
+	return columns, newRows, func(tx *internal.StateTx) error {
+		return tx.MarkProcessed(queryConfig.Name, keys)
+	}, nil
+}
+
+// refreshSeenBefore returns the time before which processed keys still in the result are
+// marked seen again, so retention doesn't forget them. Keys are refreshed once a quarter
+// of the retention passed rather than on every run, zero time means retention is off.
+func refreshSeenBefore(config internal.Config) time.Time {
+	if config.StateRetentionDays <= 0 {
+		return time.Time{}
+	}
+	retention := time.Duration(config.StateRetentionDays) * 24 * time.Hour
+	return time.Now().Add(-retention / 4)
+}
+
+// getNewRows returns rows whose keys were not processed before, and keys to mark as seen:
+// the new ones and processed ones last seen before refreshBefore.
+func getNewRows(ctx context.Context, db *sql.DB, queryConfig internal.QueryConfig, store *internal.StateStore, refreshBefore time.Time) ([]string, []internal.Row, []string, error) {
+	rows, err := db.QueryContext(ctx, queryConfig.Query)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, result, err := internal.ScanRows(rows, queryConfig.Key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var distinct []internal.Row
+	var keys []string
+	unique := make(map[string]bool)
+	for _, row := range result {
+		if unique[row.Key] {
+			continue
+		}
+		unique[row.Key] = true
+		distinct = append(distinct, row)
+		keys = append(keys, row.Key)
+	}
+	seen, err := store.ProcessedKeys(queryConfig.Name, keys)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var newRows []internal.Row
+	var mark []string
+	for _, row := range distinct {
+		seenAt, processed := seen[row.Key]
+		if !processed {
+			newRows = append(newRows, row)
+		}
+		if !processed || seenAt.Before(refreshBefore) {
+			mark = append(mark, row.Key)
+		}
+	}
+	return columns, newRows, mark, nil
+}
+
+// monitorAbsenceAndNotify fires when no new rows arrived during the query window
+// and resolves as soon as they arrive again. The last arrival is kept in the state
+// store, so restarts don't reset the window.
+func monitorAbsenceAndNotify(ctx context.Context, db *sql.DB, config internal.Config, queryConfig internal.QueryConfig, store *internal.StateStore) error {
+	window, err := time.ParseDuration(queryConfig.Window)
+	if err != nil {
+		return fmt.Errorf("window of absence query %s: %w", queryConfig.Name, err)
+	}
+
+	columns, newRows, commit, err := fetchNewRows(ctx, db, config, queryConfig, store)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	lastSeen, err := store.LastActivity(queryConfig.Name)
+	if err != nil {
+		return err
+	}
+	if len(newRows) > 0 || lastSeen.IsZero() {
+		lastSeen = now
+	}
+
+	data := internal.NewMessageData(queryConfig.Name, columns, newRows)
+	silence := now.Sub(lastSeen).Round(time.Second)
+	return store.Update(func(tx *internal.StateTx) error {
+		err := updateAlert(tx, config, queryConfig, silence >= window, data,
+			fmt.Sprintf("no new rows for %s", silence), fmt.Sprintf("%d new rows", len(newRows)))
 		if err != nil {
 			return err
 		}
 
-		processedIDs = append(processedIDs, newRows...)
-		err = writeProcessedIDs(queryConfig.Name, processedIDs, processedDir)
+		if commit != nil {
+			if err := commit(tx); err != nil {
+				return err
+			}
+		}
+		return tx.SetLastActivity(queryConfig.Name, lastSeen)
+	})
+}
+
+// monitorDiffAndNotify compares the whole result with the one of the previous run
+// and notifies which rows appeared, disappeared or changed their values.
+func monitorDiffAndNotify(ctx context.Context, db *sql.DB, config internal.Config, queryConfig internal.QueryConfig, store *internal.StateStore) error {
+	rows, err := db.QueryContext(ctx, queryConfig.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, result, err := internal.ScanRows(rows, queryConfig.Key)
+	if err != nil {
+		return err
+	}
+
+	previous, found, err := store.Snapshot(queryConfig.Name)
+	if err != nil {
+		return err
+	}
+	if !found {
+		// The first result is the baseline, otherwise all of it would be reported as appeared
+		return store.Update(func(tx *internal.StateTx) error {
+			return tx.ReplaceSnapshot(queryConfig.Name, result)
+		})
+	}
+
+	diff := internal.DiffRows(previous, result)
+	if diff.Empty() {
+		return nil
+	}
+
+	data := internal.NewDiffMessageData(queryConfig.Name, columns, result, diff)
+	message := fmt.Sprintf("%s: %s", queryConfig.Name, diff)
+	if queryConfig.Message != "" {
+		message, err = internal.RenderMessage(queryConfig.Message, data)
 		if err != nil {
 			return err
 		}
 	}
 
+	// Row tables of notifiers show what is new, disappeared rows are listed in the message
+	notification := data.Notification(message)
+	notification.Rows = append(data.Added, data.Changed...)
+	return store.Update(func(tx *internal.StateTx) error {
+		if err := enqueueNotifications(tx, config, queryConfig, notification); err != nil {
+			return err
+		}
+		return tx.ReplaceSnapshot(queryConfig.Name, result)
+	})
+}
+
+// monitorThresholdAndNotify fires when the query value crosses the threshold
+// and resolves when it goes back within the limit.
+func monitorThresholdAndNotify(ctx context.Context, db *sql.DB, config internal.Config, queryConfig internal.QueryConfig, store *internal.StateStore) error {
+	if queryConfig.Threshold == nil {
+		return fmt.Errorf("threshold query %s has no threshold", queryConfig.Name)
+	}
+
+	rows, err := db.QueryContext(ctx, queryConfig.Query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, result, err := internal.ScanRows(rows, nil)
+	if err != nil {
+		return err
+	}
+	value, err := internal.ThresholdValue(columns, result)
+	if err != nil {
+		return fmt.Errorf("threshold value of query %s: %w", queryConfig.Name, err)
+	}
+	crossed, err := queryConfig.Threshold.Crossed(value)
+	if err != nil {
+		return err
+	}
+
+	data := internal.NewMessageData(queryConfig.Name, columns, result)
+	data.Value = strconv.FormatFloat(value, 'f', -1, 64)
+
+	return store.Update(func(tx *internal.StateTx) error {
+		return updateAlert(tx, config, queryConfig, crossed, data,
+			fmt.Sprintf("value %s %s", data.Value, queryConfig.Threshold), fmt.Sprintf("value %s", data.Value))
+	})
+}
+
+// updateAlert moves the query through ok → firing → resolved and notifies on every change.
+// Nothing is sent while the condition stays the same, so restarts don't repeat alerts,
+// except Alertmanager targets which get the firing alert again to keep it active.
+// Details describe the current condition in default messages when the query has no templates.
+func updateAlert(tx *internal.StateTx, config internal.Config, queryConfig internal.QueryConfig, firing bool, data internal.MessageData, firingDetails, resolvedDetails string) error {
+	alert, err := tx.AlertState(queryConfig.Name)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	if firing && alert.State != internal.AlertFiring {
+		data.Status = internal.AlertFiring
+		message, err := alertMessage(queryConfig.Message, data, fmt.Sprintf("%s: %s", queryConfig.Name, firingDetails))
+		if err != nil {
+			return err
+		}
+
+		// Routes may select other targets for the resolved notification, it goes where this one went
+		notification := data.Notification(message)
+		targets, err := config.QueryTargets(queryConfig, notification)
+		if err != nil {
+			return err
+		}
+		names := make([]string, len(targets))
+		for i, target := range targets {
+			names[i] = target.Name
+		}
+		if err := tx.SetAlertTargets(queryConfig.Name, names); err != nil {
+			return err
+		}
+
+		if err := enqueueNotifications(tx, config, queryConfig, notification); err != nil {
+			return err
+		}
+		return tx.FireAlert(queryConfig.Name, now)
+	}
+
+	if firing && alert.State == internal.AlertFiring {
+		return repeatFiring(tx, config, queryConfig, data, firingDetails)
+	}
+
+	if !firing && alert.State == internal.AlertFiring {
+		data.Status = internal.AlertResolved
+		data.Duration = now.Sub(alert.Since).Round(time.Second)
+		message, err := alertMessage(queryConfig.ResolvedMessage, data, fmt.Sprintf("%s: resolved after %s, %s", queryConfig.Name, data.Duration, resolvedDetails))
+		if err != nil {
+			return err
+		}
+
+		err = enqueueNotifications(tx, config, queryConfig, data.Notification(message))
+		if err != nil {
+			return err
+		}
+
+		incident, err := tx.ResolveAlert(queryConfig.Name, now)
+		if err != nil {
+			return err
+		}
+		log.Printf("Incident of query %s lasted %s", queryConfig.Name, incident.Duration().Round(time.Second))
+	}
+
 	return nil
 }
 
-func getNewRows(db *sql.DB, query string, processedIDs []int) ([]int, error) {
-	rows, err := db.Query(query)
+// repeatFiring sends the firing notification again to Alertmanager targets of the query, which
+// resolves alerts not repeated before their end. Nothing is repeated to a target while an earlier
+// notification waits for its delivery, or while the query is in quiet hours or maintenance window.
+func repeatFiring(tx *internal.StateTx, config internal.Config, queryConfig internal.QueryConfig, data internal.MessageData, firingDetails string) error {
+	names, err := tx.AlertTargets(queryConfig.Name)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	var targets []internal.Target
+	for _, target := range config.TargetsByName(queryConfig, names) {
+		if target.Notifier != internal.NotifierAlertmanager {
+			continue
+		}
+		pending, err := tx.Pending(queryConfig.Name, target.Name)
+		if err != nil {
+			return err
+		}
+		if !pending {
+			targets = append(targets, target)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	windows, err := tx.ActiveMaintenance(now)
+	if err != nil {
+		return err
+	}
+	suppression, err := config.QuerySuppression(queryConfig, windows, now)
+	if err != nil || suppression != nil {
+		return err
+	}
+
+	data.Status = internal.AlertFiring
+	message, err := alertMessage(queryConfig.Message, data, fmt.Sprintf("%s: %s", queryConfig.Name, firingDetails))
+	if err != nil {
+		return err
+	}
+	notification := data.Notification(message)
+	notification.Repeat = true
+
+	entries := make([]internal.OutboxEntry, len(targets))
+	for i, target := range targets {
+		if entries[i], err = internal.NewOutboxEntry(queryConfig.Name, target.Name, notification); err != nil {
+			return err
+		}
+	}
+	return tx.Enqueue(entries...)
+}
+
+func alertMessage(message string, data internal.MessageData, fallback string) (string, error) {
+	if message == "" {
+		return fallback, nil
+	}
+	return internal.RenderMessage(message, data)
+}
+
+// getRowsAfterCursor runs the query with the last seen value as its only bind parameter
+// and returns the rows together with the greatest key value among them.
+func getRowsAfterCursor(ctx context.Context, db *sql.DB, queryConfig internal.QueryConfig, cursor any) ([]string, []internal.Row, any, error) {
+	if len(queryConfig.Key) > 1 {
+		return nil, nil, nil, fmt.Errorf("cursor mode of query %s needs a single key column", queryConfig.Name)
+	}
+
+	rows, err := db.QueryContext(ctx, queryConfig.Query, cursor)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 	defer rows.Close()
 
-	var newRows []int
-	for rows.Next() {
-		var id int
-		err := rows.Scan(&id)
+	columns, result, err := internal.ScanRows(rows, queryConfig.Key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	next := cursor
+	for _, row := range result {
+		switch queryConfig.Cursor {
+		case internal.CursorID:
+			id, err := strconv.ParseInt(row.Key, 10, 64)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("cursor value %q of query %s: %w", row.Key, queryConfig.Name, err)
+			}
+			if id > next.(int64) {
+				next = id
+			}
+		case internal.CursorTimestamp:
+			ts, err := parseCursorTime(row.Key)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("cursor value %q of query %s: %w", row.Key, queryConfig.Name, err)
+			}
+			if ts.After(next.(time.Time)) {
+				next = ts
+			}
+		}
+	}
+	return columns, result, next, nil
+}
+
+// parseCursorTime accepts timestamps scanned as time.Time as well as text ones stored by SQLite.
+func parseCursorTime(value string) (time.Time, error) {
+	layouts := []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999"}
+
+	var err error
+	for _, layout := range layouts {
+		var ts time.Time
+		if ts, err = time.Parse(layout, value); err == nil {
+			return ts, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func rowsNotification(config internal.Config, queryConfig internal.QueryConfig, columns []string, rows []internal.Row) (internal.Notification, error) {
+	data := internal.NewMessageData(queryConfig.Name, columns, rows)
+	message, err := internal.RenderMessage(config.QueryMessage(queryConfig), data)
+	if err != nil {
+		return internal.Notification{}, err
+	}
+	return data.Notification(message), nil
+}
+
+// enqueueNotifications queues the notification for every target of the query. It is sent
+// by the delivery loop once the transaction which remembers the handled rows is committed.
+// Notifications held by digest, cooldown or rate limit of the query are sent later as a summary.
+func enqueueNotifications(tx *internal.StateTx, config internal.Config, queryConfig internal.QueryConfig, notification internal.Notification) error {
+	throttle, err := config.QueryThrottle(queryConfig)
+	if err != nil {
+		return err
+	}
+	send, err := tx.Throttle(queryConfig.Name, throttle, notification, time.Now())
+	if err != nil || !send {
+		return err
+	}
+	return queueNotification(tx, config, queryConfig, notification)
+}
+
+// queueNotification drops the notification during quiet hours or maintenance windows which drop
+// notifications, deferred ones stay in the outbox until the window ends.
+func queueNotification(tx *internal.StateTx, config internal.Config, queryConfig internal.QueryConfig, notification internal.Notification) error {
+	now := time.Now()
+	windows, err := tx.ActiveMaintenance(now)
+	if err != nil {
+		return err
+	}
+	suppression, err := config.QuerySuppression(queryConfig, windows, now)
+	if err != nil {
+		return err
+	}
+	if suppression != nil && suppression.Action == internal.SuppressDrop {
+		log.Printf("Notification for query %s dropped during %s", queryConfig.Name, suppression.Reason)
+		return nil
+	}
+	if suppression != nil {
+		log.Printf("Notification for query %s deferred by %s until %s", queryConfig.Name, suppression.Reason, suppression.Until.Format(time.DateTime))
+	}
+
+	targets, err := notificationTargets(tx, config, queryConfig, notification)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]internal.OutboxEntry, len(targets))
+	for i, target := range targets {
+		if entries[i], err = internal.NewOutboxEntry(queryConfig.Name, target.Name, notification); err != nil {
+			return err
+		}
+	}
+	return tx.Enqueue(entries...)
+}
+
+// notificationTargets resolves targets of the notification by routes, except resolved
+// notifications which go to the targets of the firing one.
+func notificationTargets(tx *internal.StateTx, config internal.Config, queryConfig internal.QueryConfig, notification internal.Notification) ([]internal.Target, error) {
+	if notification.Status == internal.AlertResolved {
+		names, err := tx.AlertTargets(queryConfig.Name)
 		if err != nil {
 			return nil, err
 		}
-		if !contains(processedIDs, id) {
-			newRows = append(newRows, id)
+		return config.TargetsByName(queryConfig, names), nil
+	}
+	return config.QueryTargets(queryConfig, notification)
+}
+
+// runDelivery sends queued notifications as soon as a query queues them and retries
+// failed ones when their backoff is over.
+func runDelivery(config internal.Config, store *internal.StateStore) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		releaseHeld(config, store)
+
+		// Every pass sends the oldest notification of each query and target, repeat while there is progress
+		for deliverOutbox(config, store) > 0 {
+		}
+
+		select {
+		case <-deliveryWake:
+		case <-ticker.C:
 		}
 	}
-	return newRows, nil
 }
 
-func sendNotifications(config internal.Config, queryConfig internal.QueryConfig, newRows []int) error {
-	var url string
-	if queryConfig.NotificationURL != "" {
-		url = queryConfig.NotificationURL
-	} else {
-		url = config.BaseNotificationURL
+func wakeDelivery() {
+	select {
+	case deliveryWake <- struct{}{}:
+	default:
+	}
+}
+
+// releaseHeld queues summaries of held notifications whose digest window, cooldown or rate limit is over.
+func releaseHeld(config internal.Config, store *internal.StateStore) {
+	now := time.Now()
+	due, err := store.DueHeld(now)
+	if err != nil {
+		log.Printf("Error during delivery: %v", err)
+		return
+	}
+
+	for _, held := range due {
+		err := store.Update(func(tx *internal.StateTx) error {
+			if err := tx.ReleaseHeld(held.Query, now); err != nil {
+				return err
+			}
+			queryConfig, ok := config.QueryByName(held.Query)
+			if !ok {
+				return nil
+			}
+			return queueNotification(tx, config, queryConfig, held.Summary(now))
+		})
+		if err != nil {
+			log.Printf("Error releasing held notifications of query %s: %v", held.Query, err)
+		}
+	}
+}
+
+// deliverOutbox tries every due notification whose target circuit is closed and returns how many were sent.
+// Notifications to a target over its rate limit wait until it allows the next one, notifications
+// of a query in quiet hours or maintenance window wait until it ends.
+func deliverOutbox(config internal.Config, store *internal.StateStore) int {
+	now := time.Now()
+	entries, err := store.DueOutbox(now)
+	if err != nil {
+		log.Printf("Error during delivery: %v", err)
+		return 0
 	}
 
-	message := fmt.Sprintf(queryConfig.Name+": "+config.NotificationMessage, len(newRows))
-	payload := strings.NewReader(message)
+	windows, err := store.ActiveMaintenance(now)
+	if err != nil {
+		log.Printf("Error during delivery: %v", err)
+		return 0
+	}
+
+	sent := 0
+	for _, entry := range entries {
+		if queryConfig, ok := config.QueryByName(entry.Query); ok {
+			suppression, err := config.QuerySuppression(queryConfig, windows, now)
+			if err != nil {
+				log.Printf("Error during delivery: %v", err)
+				continue
+			}
+			if suppression != nil {
+				continue
+			}
+		}
+
+		open, err := store.CircuitOpen(entry.Target, now)
+		if err != nil {
+			log.Printf("Error during delivery: %v", err)
+			return sent
+		}
+		if open {
+			continue
+		}
+
+		if rateLimit := config.Targets[entry.Target].RateLimit; rateLimit != nil && !entry.Notification.Repeat {
+			until, err := targetRateLimited(store, entry.Target, *rateLimit, now)
+			if err != nil {
+				log.Printf("Error during delivery: %v", err)
+				return sent
+			}
+			if !until.IsZero() {
+				if err := store.Postpone(entry, until); err != nil {
+					log.Printf("Error during delivery: %v", err)
+					return sent
+				}
+				continue
+			}
+		}
+
+		err = deliver(config, entry)
+		if err == nil {
+			if err := store.Delivered(entry, time.Now()); err != nil {
+				log.Printf("Error during delivery: %v", err)
+				return sent
+			}
+			sent++
+			log.Printf("Notification sent for query %s to %s: %s", entry.Query, entry.Target, entry.Notification.Message)
+			continue
+		}
+
+		dead, storeErr := store.DeliveryFailed(entry, err, time.Now())
+		if storeErr != nil {
+			log.Printf("Error during delivery: %v", storeErr)
+			return sent
+		}
+		if dead {
+			log.Printf("Notification for query %s to %s moved to dead letters after %d attempts: %v", entry.Query, entry.Target, entry.Attempts+1, err)
+		} else {
+			log.Printf("Error sending notification for query %s to %s (attempt %d): %v", entry.Query, entry.Target, entry.Attempts+1, err)
+		}
+	}
+	return sent
+}
 
-	resp, err := http.Post(url, "text/plain", payload)
+func targetRateLimited(store *internal.StateStore, target string, rateLimit internal.RateLimitConfig, at time.Time) (time.Time, error) {
+	limit, err := rateLimit.Parse()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("target %s: %w", target, err)
+	}
+	return store.TargetRateLimited(target, limit, at)
+}
+
+// deliver sends the notification with current settings of its query and target,
+// so fixing the config also fixes pending retries.
+func deliver(config internal.Config, entry internal.OutboxEntry) error {
+	queryConfig, ok := config.QueryByName(entry.Query)
+	if !ok {
+		return fmt.Errorf("query %s is not configured", entry.Query)
+	}
+	target, err := config.QueryTarget(queryConfig, entry.Target)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP request failed with status code: %d", resp.StatusCode)
+	notifier, err := internal.NewNotifier(&config, queryConfig.WithTarget(target))
+	if err != nil {
+		return err
 	}
 
-	log.Printf("Notification sent for query %s: %s", queryConfig.Name, message)
-	return nil
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+	return notifier.Notify(ctx, entry.Notification)
 }
 
 func loadConfig(filename string) (internal.Config, error) {
@@ -254,52 +970,214 @@ func loadConfig(filename string) (internal.Config, error) {
 	return config, nil
 }
 
-func readProcessedIDs(queryName, directory string) ([]int, error) {
-	filePath := filepath.Join(directory, fmt.Sprintf("%s_%s", queryName, "processed_ids.txt"))
+func readCursor(queryConfig internal.QueryConfig, store *internal.StateStore) (any, error) {
+	value, err := store.Cursor(queryConfig.Name)
+	if err != nil {
+		return nil, err
+	}
 
-	// Check if the file exists, and create it if not
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		if _, err := os.Create(filePath); err != nil {
-			return nil, err
+	switch queryConfig.Cursor {
+	case internal.CursorID:
+		if value == "" {
+			return int64(0), nil
+		}
+		return strconv.ParseInt(value, 10, 64)
+	case internal.CursorTimestamp:
+		if value == "" {
+			return time.Unix(0, 0).UTC(), nil
 		}
+		return time.Parse(time.RFC3339Nano, value)
+	}
+	return nil, fmt.Errorf("unknown cursor mode %q for query %s", queryConfig.Cursor, queryConfig.Name)
+}
+
+func writeCursor(tx *internal.StateTx, queryConfig internal.QueryConfig, cursor any) error {
+	var value string
+	switch cursor := cursor.(type) {
+	case int64:
+		value = strconv.FormatInt(cursor, 10)
+	case time.Time:
+		value = cursor.Format(time.RFC3339Nano)
+	}
+
+	return tx.SetCursor(queryConfig.Name, value)
+}
+
+func pruneState(config internal.Config, store *internal.StateStore) {
+	if _, err := store.PruneSends(time.Now().Add(-config.ThrottleWindow())); err != nil {
+		log.Printf("Error during state pruning: %v", err)
+	}
+	if _, err := store.PruneMaintenance(time.Now()); err != nil {
+		log.Printf("Error during state pruning: %v", err)
+	}
+
+	if config.StateRetentionDays <= 0 {
+		return
 	}
 
-	content, err := os.ReadFile(filePath)
+	before := time.Now().AddDate(0, 0, -config.StateRetentionDays)
+	removed, err := store.Prune(before)
 	if err != nil {
-		return nil, err
+		log.Printf("Error during state pruning: %v", err)
+		return
+	}
+	if removed > 0 {
+		log.Printf("Forgot %d processed IDs older than %d days", removed, config.StateRetentionDays)
 	}
+}
 
-	var processedIDs []int
-	ids := strings.Split(string(content), "\n")
-	for _, idStr := range ids {
-		if idStr != "" {
-			id, err := strconv.Atoi(idStr)
-			if err != nil {
-				return nil, err
-			}
-			processedIDs = append(processedIDs, id)
+// deadLetters lists notifications which failed every attempt, "retry" moves them back
+// to the outbox and "purge" forgets them. Both take IDs or act on all dead letters.
+func deadLetters(args []string) {
+	store := openStateStore()
+	defer store.Close()
+
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	var ids []int64
+	for _, arg := range args {
+		id, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid dead letter ID %q", arg)
 		}
+		ids = append(ids, id)
 	}
 
-	return processedIDs, nil
+	switch action {
+	case "list":
+		entries, err := store.DeadLetters()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No dead letters")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCREATED\tQUERY\tTARGET\tATTEMPTS\tLAST ERROR")
+		for _, entry := range entries {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\n", entry.ID, entry.CreatedAt.Format(time.DateTime),
+				entry.Query, entry.Target, entry.Attempts, entry.LastError)
+		}
+		w.Flush()
+	case "retry":
+		moved, err := store.RetryDeadLetters(ids...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d notifications moved back to outbox, running sqlal will send them\n", moved)
+	case "purge":
+		removed, err := store.PurgeDeadLetters(ids...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d dead letters removed\n", removed)
+	default:
+		fmt.Println("Usage: sqlal deadletters [list | retry [ID...] | purge [ID...]]")
+		os.Exit(1)
+	}
 }
-func writeProcessedIDs(queryName string, processedIDs []int, directory string) error {
-	filePath := filepath.Join(directory, fmt.Sprintf("%s_%s", queryName, "processed_ids.txt"))
-	idStr := ""
-	for _, id := range processedIDs {
-		idStr += fmt.Sprint(id) + "\n"
+
+// maintenance lists active maintenance windows, "start" opens a window for some queries
+// or all of them and "end" closes windows before their time, all of them without IDs.
+func maintenance(args []string) {
+	store := openStateStore()
+	defer store.Close()
+
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
 	}
 
-	return os.WriteFile(filePath, []byte(idStr), 0644)
-}
+	switch action {
+	case "list":
+		windows, err := store.ActiveMaintenance(time.Now())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(windows) == 0 {
+			fmt.Println("No maintenance windows")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTARTED\tENDS\tQUERY\tACTION\tREASON")
+		for _, window := range windows {
+			query := window.Query
+			if query == "" {
+				query = "*"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", window.ID, window.StartsAt.Format(time.DateTime),
+				window.EndsAt.Format(time.DateTime), query, window.Action, window.Reason)
+		}
+		w.Flush()
+	case "start":
+		flags := flag.NewFlagSet("maintenance start", flag.ExitOnError)
+		drop := flags.Bool("drop", false, "Drop notifications instead of sending them after the window")
+		reason := flags.String("reason", "", "Why notifications are suppressed")
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			fmt.Println("Usage: sqlal maintenance start [-drop] [-reason text] <duration> [query...]")
+			os.Exit(1)
+		}
+
+		duration, err := time.ParseDuration(flags.Arg(0))
+		if err != nil || duration <= 0 {
+			log.Fatalf("Invalid maintenance duration %q", flags.Arg(0))
+		}
+		queries := flags.Args()[1:]
+		if len(queries) > 0 {
+			config, err := loadConfig(configFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, query := range queries {
+				if _, ok := config.QueryByName(query); !ok {
+					log.Fatalf("Query %s is not configured", query)
+				}
+			}
+		} else {
+			// An empty query name covers all queries
+			queries = []string{""}
+		}
+
+		window := internal.MaintenanceWindow{Action: internal.SuppressDefer, Reason: *reason, StartsAt: time.Now()}
+		suppressed := "deferred"
+		if *drop {
+			window.Action, suppressed = internal.SuppressDrop, "dropped"
+		}
+		window.EndsAt = window.StartsAt.Add(duration)
+		for _, query := range queries {
+			window.Query = query
+			id, err := store.StartMaintenance(window)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("Maintenance window %d started until %s, notifications are %s\n", id, window.EndsAt.Format(time.DateTime), suppressed)
+		}
+	case "end":
+		var ids []int64
+		for _, arg := range args {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				log.Fatalf("Invalid maintenance window ID %q", arg)
+			}
+			ids = append(ids, id)
+		}
 
-func contains(slice []int, item int) bool {
-	for _, i := range slice {
-		if i == item {
-			return true
+		ended, err := store.EndMaintenance(time.Now(), ids...)
+		if err != nil {
+			log.Fatal(err)
 		}
+		fmt.Printf("%d maintenance windows ended\n", ended)
+	default:
+		fmt.Println("Usage: sqlal maintenance [list | start [-drop] [-reason text] <duration> [query...] | end [ID...]]")
+		os.Exit(1)
 	}
-	return false
 }
 
 func start() {
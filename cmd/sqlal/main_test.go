@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yendefrr/sql-alerts/internal"
+)
+
+func TestParseCursorTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2024-05-01T10:20:30Z", time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC)},
+		{"2024-05-01T10:20:30.123456+02:00", time.Date(2024, 5, 1, 8, 20, 30, 123456000, time.UTC)},
+		{"2024-05-01 10:20:30+02:00", time.Date(2024, 5, 1, 8, 20, 30, 0, time.UTC)},
+		{"2024-05-01 10:20:30.5", time.Date(2024, 5, 1, 10, 20, 30, 500000000, time.UTC)},
+		{"2024-05-01 10:20:30", time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseCursorTime(tt.value)
+		if err != nil {
+			t.Errorf("parseCursorTime(%q): %v", tt.value, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseCursorTime(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "yesterday", "2024-05-01"} {
+		if _, err := parseCursorTime(value); err == nil {
+			t.Errorf("parseCursorTime(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestGetNewRows(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite", filepath.Join(dir, "source.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE orders (id INTEGER, email TEXT);
+		INSERT INTO orders VALUES (1, 'a@x'), (2, 'b@x'), (2, 'b@x'), (3, 'c@x')`); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := internal.OpenStateStore(filepath.Join(dir, "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	query := internal.QueryConfig{Name: "orders", Query: "SELECT id, email FROM orders ORDER BY id"}
+
+	// Keys 1 and 2 were processed just now
+	err = store.Update(func(tx *internal.StateTx) error {
+		return tx.MarkProcessed("orders", []string{"1", "2"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		refreshBefore time.Time
+		wantMark      []string
+	}{
+		{"retention off", time.Time{}, []string{"3"}},
+		{"recently seen", time.Now().Add(-time.Hour), []string{"3"}},
+		{"seen before refresh time", time.Now().Add(time.Hour), []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, newRows, mark, err := getNewRows(context.Background(), db, query, store, tt.refreshBefore)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(newRows) != 1 || newRows[0].Key != "3" {
+				t.Errorf("new rows = %+v, want the row with key 3", newRows)
+			}
+			if !slices.Equal(mark, tt.wantMark) {
+				t.Errorf("keys to mark = %v, want %v", mark, tt.wantMark)
+			}
+		})
+	}
+}
+
+func openTestStore(t *testing.T) *internal.StateStore {
+	t.Helper()
+	store, err := internal.OpenStateStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func updateAlertTest(t *testing.T, store *internal.StateStore, config internal.Config, query internal.QueryConfig, firing bool) {
+	t.Helper()
+	err := store.Update(func(tx *internal.StateTx) error {
+		return updateAlert(tx, config, query, firing, internal.NewMessageData(query.Name, nil, nil), "condition", "recovered")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deliverAll marks every queued notification delivered and returns them.
+func deliverAll(t *testing.T, store *internal.StateStore) []internal.OutboxEntry {
+	t.Helper()
+	var delivered []internal.OutboxEntry
+	for {
+		entries, err := store.DueOutbox(time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 {
+			return delivered
+		}
+		for _, entry := range entries {
+			if err := store.Delivered(entry, time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		delivered = append(delivered, entries...)
+	}
+}
+
+func TestUpdateAlertRepeatsToAlertmanager(t *testing.T) {
+	store := openTestStore(t)
+	config := internal.Config{
+		Databases: map[string]internal.DatabaseConfig{"default": {}},
+		Targets: map[string]internal.NamedTarget{
+			"am":   {TargetConfig: internal.TargetConfig{Notifier: internal.NotifierAlertmanager, NotificationURL: "http://alertmanager:9093"}},
+			"chat": {TargetConfig: internal.TargetConfig{Notifier: internal.NotifierSlack, NotificationURL: "https://hooks.slack.com/services/T/B/X"}},
+		},
+	}
+	query := internal.QueryConfig{Name: "orders", Targets: []string{"am", "chat"}}
+
+	updateAlertTest(t, store, config, query, true)
+	// Not repeated while the firing alert waits for delivery
+	updateAlertTest(t, store, config, query, true)
+	if sent := deliverAll(t, store); len(sent) != 2 || sent[0].Notification.Repeat || sent[1].Notification.Repeat {
+		t.Fatalf("firing notifications = %+v, want one to each target", sent)
+	}
+
+	updateAlertTest(t, store, config, query, true)
+	sent := deliverAll(t, store)
+	if len(sent) != 1 || sent[0].Target != "am" || !sent[0].Notification.Repeat || sent[0].Notification.Status != internal.AlertFiring {
+		t.Fatalf("repeated notifications = %+v, want the firing alert to am", sent)
+	}
+	// Repeats don't count for rate limits
+	until, err := store.TargetRateLimited("am", internal.RateLimit{Count: 2, Per: time.Hour}, time.Now())
+	if err != nil || !until.IsZero() {
+		t.Errorf("am is rate limited until %s by repeats, %v", until, err)
+	}
+
+	// During maintenance nothing is repeated
+	_, err = store.StartMaintenance(internal.MaintenanceWindow{Action: internal.SuppressDrop, StartsAt: time.Now().Add(-time.Minute), EndsAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updateAlertTest(t, store, config, query, true)
+	if sent := deliverAll(t, store); len(sent) != 0 {
+		t.Errorf("repeated during maintenance: %+v", sent)
+	}
+}
+
+func TestUpdateAlertLifecycle(t *testing.T) {
+	store := openTestStore(t)
+	config := internal.Config{BaseNotificationURL: "https://ntfy.sh/sqlal"}
+	query := internal.QueryConfig{Name: "orders"}
+
+	alertState := func() internal.AlertState {
+		t.Helper()
+		var alert internal.AlertState
+		err := store.Update(func(tx *internal.StateTx) (err error) {
+			alert, err = tx.AlertState(query.Name)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return alert
+	}
+
+	updateAlertTest(t, store, config, query, false)
+	if sent := deliverAll(t, store); len(sent) != 0 || alertState().State != internal.AlertOK {
+		t.Fatalf("ok query notified: %+v", sent)
+	}
+
+	// Firing is sent once while the condition holds
+	for i := 0; i < 3; i++ {
+		updateAlertTest(t, store, config, query, true)
+	}
+	sent := deliverAll(t, store)
+	if len(sent) != 1 || sent[0].Notification.Status != internal.AlertFiring || sent[0].Notification.Message != "orders: condition" {
+		t.Fatalf("firing notifications = %+v, want one", sent)
+	}
+	firing := alertState()
+	if firing.State != internal.AlertFiring {
+		t.Fatalf("state = %+v, want firing", firing)
+	}
+
+	updateAlertTest(t, store, config, query, false)
+	updateAlertTest(t, store, config, query, false)
+	sent = deliverAll(t, store)
+	if len(sent) != 1 || sent[0].Notification.Status != internal.AlertResolved || sent[0].Target != "query:orders" {
+		t.Fatalf("resolved notifications = %+v, want one to the firing target", sent)
+	}
+	if !strings.HasPrefix(sent[0].Notification.Message, "orders: resolved after ") || !strings.HasSuffix(sent[0].Notification.Message, ", recovered") {
+		t.Errorf("resolved message = %q", sent[0].Notification.Message)
+	}
+	if resolved := alertState(); resolved.State != internal.AlertResolved || resolved.Since.Before(firing.Since) {
+		t.Errorf("state = %+v, want resolved", resolved)
+	}
+
+	// Firing again opens a new incident
+	updateAlertTest(t, store, config, query, true)
+	if sent := deliverAll(t, store); len(sent) != 1 || sent[0].Notification.Status != internal.AlertFiring {
+		t.Errorf("second firing notifications = %+v", sent)
+	}
+}
+
+func TestAbsenceWindowSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite", filepath.Join(dir, "source.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE events (id INTEGER); INSERT INTO events VALUES (1)`); err != nil {
+		t.Fatal(err)
+	}
+
+	statePath := filepath.Join(dir, "state.db")
+	store, err := internal.OpenStateStore(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := internal.Config{BaseNotificationURL: "https://ntfy.sh/sqlal"}
+	query := internal.QueryConfig{Name: "events", Type: internal.QueryTypeAbsence, Window: "1h", Query: "SELECT id FROM events"}
+	monitor := func() {
+		t.Helper()
+		if err := monitorAbsenceAndNotify(context.Background(), db, config, query, store); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	monitor()
+	if sent := deliverAll(t, store); len(sent) != 0 {
+		t.Fatalf("notified with new rows: %+v", sent)
+	}
+
+	// The last rows arrived two hours ago, before a restart
+	lastSeen := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	if err := store.Update(func(tx *internal.StateTx) error { return tx.SetLastActivity(query.Name, lastSeen) }); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+	if store, err = internal.OpenStateStore(statePath); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if got, err := store.LastActivity(query.Name); err != nil || !got.Equal(lastSeen) {
+		t.Fatalf("last activity after reopening = %s, %v, want %s", got, err, lastSeen)
+	}
+
+	monitor()
+	sent := deliverAll(t, store)
+	if len(sent) != 1 || sent[0].Notification.Status != internal.AlertFiring || !strings.HasPrefix(sent[0].Notification.Message, "events: no new rows for 2h") {
+		t.Fatalf("firing notifications = %+v", sent)
+	}
+	if got, _ := store.LastActivity(query.Name); !got.Equal(lastSeen) {
+		t.Errorf("last activity moved to %s without new rows", got)
+	}
+
+	if _, err := db.Exec(`INSERT INTO events VALUES (2)`); err != nil {
+		t.Fatal(err)
+	}
+	monitor()
+	sent = deliverAll(t, store)
+	if len(sent) != 1 || sent[0].Notification.Status != internal.AlertResolved || !strings.HasSuffix(sent[0].Notification.Message, "1 new rows") {
+		t.Fatalf("resolved notifications = %+v", sent)
+	}
+	if got, _ := store.LastActivity(query.Name); !got.After(lastSeen) {
+		t.Errorf("last activity = %s, want the arrival of new rows", got)
+	}
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Alertmanager resolves alerts which are not repeated before their end, sqlal repeats firing
+// alerts on every run of the query. They end after this time unless repeated or resolved earlier.
+const alertmanagerFiringTTL = 24 * time.Hour
+
+type alertmanagerNotifier struct {
+	url    string
+	labels map[string]string
+}
+
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    string            `json:"startsAt,omitempty"`
+	EndsAt      string            `json:"endsAt,omitempty"`
+}
+
+func newAlertmanagerNotifier(config *Config, query QueryConfig) (Notifier, error) {
+	database, err := config.QueryDatabase(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return alertmanagerNotifier{
+		url: strings.TrimRight(query.NotificationURL, "/") + "/api/v2/alerts",
+		labels: map[string]string{
+			"alertname": query.Name,
+			"query":     query.Name,
+			"database":  database,
+			"severity":  config.QuerySeverity(query),
+		},
+	}, nil
+}
+
+// Notify posts the alert to Alertmanager, so it is grouped, silenced and routed there.
+// Resolved alerts are posted with the end time which closes them.
+func (a alertmanagerNotifier) Notify(ctx context.Context, n Notification) error {
+	at := n.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	alert := alertmanagerAlert{
+		Labels:      a.labels,
+		Annotations: map[string]string{"summary": n.Message},
+	}
+	if len(n.Rows) > 0 && len(n.Columns) > 0 {
+		alert.Annotations["description"] = textTable(n.Columns, n.Rows)
+	}
+
+	switch n.Status {
+	case AlertResolved:
+		// Alertmanager keeps the start of the existing alert, it is only set for validation: end may not precede start
+		alert.StartsAt = at.Format(time.RFC3339)
+		alert.EndsAt = at.Format(time.RFC3339)
+	case AlertFiring:
+		alert.StartsAt = at.Format(time.RFC3339)
+		alert.EndsAt = at.Add(alertmanagerFiringTTL).Format(time.RFC3339)
+	default:
+		// New rows are events, Alertmanager resolves them after its resolve_timeout
+		alert.StartsAt = at.Format(time.RFC3339)
+	}
+
+	body, err := json.Marshal([]alertmanagerAlert{alert})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doRequest(req, http.StatusOK)
+}
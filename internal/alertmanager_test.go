@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAlertmanagerNotify(t *testing.T) {
+	server, requests := recordServer(t, http.StatusOK)
+	config := &Config{Databases: map[string]DatabaseConfig{"shop": {}}}
+	query := QueryConfig{Name: "orders", Severity: SeverityWarning,
+		TargetConfig: TargetConfig{Notifier: NotifierAlertmanager, NotificationURL: server.URL + "/"}}
+	at := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		status   string
+		wantEnds string
+	}{
+		{AlertFiring, "2024-05-02T10:00:00Z"},
+		{AlertResolved, "2024-05-01T10:00:00Z"},
+		{"", ""},
+	}
+	for i, tt := range tests {
+		n := testNotification()
+		n.Status = tt.status
+		if err := notify(t, config, query, n); err != nil {
+			t.Fatal(err)
+		}
+
+		got := requests()[i]
+		if got.Path != "/api/v2/alerts" {
+			t.Errorf("%q: path = %s, want /api/v2/alerts", tt.status, got.Path)
+		}
+		var alerts []alertmanagerAlert
+		if err := json.Unmarshal([]byte(got.Body), &alerts); err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != 1 {
+			t.Fatalf("%q: got %d alerts, want 1", tt.status, len(alerts))
+		}
+		alert := alerts[0]
+		labels := map[string]string{"alertname": "orders", "query": "orders", "database": "shop", "severity": SeverityWarning}
+		for name, value := range labels {
+			if alert.Labels[name] != value {
+				t.Errorf("%q: label %s = %q, want %q", tt.status, name, alert.Labels[name], value)
+			}
+		}
+		if alert.Annotations["summary"] != n.Message || alert.Annotations["description"] != textTable(n.Columns, n.Rows) {
+			t.Errorf("%q: annotations = %v", tt.status, alert.Annotations)
+		}
+		if alert.StartsAt != at.Format(time.RFC3339) || alert.EndsAt != tt.wantEnds {
+			t.Errorf("%q: startsAt %q, endsAt %q, want %q", tt.status, alert.StartsAt, alert.EndsAt, tt.wantEnds)
+		}
+	}
+}
+
+func TestAlertmanagerUnknownDatabase(t *testing.T) {
+	query := QueryConfig{Name: "orders", Database: "missing",
+		TargetConfig: TargetConfig{Notifier: NotifierAlertmanager, NotificationURL: "http://alertmanager:9093"}}
+	if _, err := NewNotifier(&Config{}, query); err == nil {
+		t.Error("alertmanager notifier with unknown database was built")
+	}
+}
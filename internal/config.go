@@ -2,47 +2,240 @@ package internal
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
+	"sort"
+)
+
+const DefaultDatabaseName = "default"
+
+// Query types: new rows are notified once, threshold alerts on a numeric result crossing a limit,
+// absence alerts when no new rows arrive for a window, diff notifies about any change of the result.
+const (
+	QueryTypeNewRows   = "new_rows"
+	QueryTypeThreshold = "threshold"
+	QueryTypeAbsence   = "absence"
+	QueryTypeDiff      = "diff"
+)
+
+// Cursor modes remember only the last seen value instead of every processed ID.
+const (
+	CursorID        = "id"
+	CursorTimestamp = "timestamp"
+)
+
+// Alert severities, notifiers map them to their own levels.
+const (
+	SeverityCritical = "critical"
+	SeverityError    = "error"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
 )
 
 type Config struct {
-	Database             DatabaseConfig `json:"database"`
-	Queries              []QueryConfig  `json:"queries"`
-	BaseNotificationURL  string         `json:"baseNotificationUrl"`
-	NotificationMessage  string         `json:"notificationMessage"`
-	CheckIntervalSeconds int            `json:"checkIntervalSeconds"`
+	Databases            map[string]DatabaseConfig `json:"databases"`
+	Queries              []QueryConfig             `json:"queries"`
+	BaseNotificationURL  string                    `json:"baseNotificationUrl"`
+	NotificationMessage  string                    `json:"notificationMessage"`
+	CheckIntervalSeconds int                       `json:"checkIntervalSeconds"`
+	QueryTimeoutSeconds  int                       `json:"queryTimeoutSeconds,omitempty"`
+	Workers              int                       `json:"workers,omitempty"`
+	StateRetentionDays   int                       `json:"stateRetentionDays,omitempty"`
+	Telegram             *TelegramConfig           `json:"telegram,omitempty"`
+	SMTP                 *SMTPConfig               `json:"smtp,omitempty"`
+	PagerDuty            *PagerDutyConfig          `json:"pagerDuty,omitempty"`
+	Opsgenie             *OpsgenieConfig           `json:"opsgenie,omitempty"`
+	Ntfy                 *NtfyConfig               `json:"ntfy,omitempty"`
+	Targets              map[string]NamedTarget    `json:"targets,omitempty"`
+	Routes               []RouteConfig             `json:"routes,omitempty"`
+}
+
+// UnmarshalJSON also accepts the legacy single "database" section
+// and turns it into the default connection.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	aux := struct {
+		*plain
+		Database *DatabaseConfig `json:"database"`
+	}{plain: (*plain)(c)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if aux.Database != nil && len(c.Databases) == 0 {
+		c.Databases = map[string]DatabaseConfig{DefaultDatabaseName: *aux.Database}
+	}
+	return nil
 }
 
 type DatabaseConfig struct {
+	Driver   string `json:"driver"`
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Host     string `json:"host"`
 	Port     string `json:"port"`
 	Name     string `json:"name"`
+	SSLMode  string `json:"sslMode,omitempty"`
+	Path     string `json:"path,omitempty"`
 }
 
 type QueryConfig struct {
-	Name            string `json:"name"`
-	Query           string `json:"query"`
-	NotificationURL string `json:"notificationUrl"`
-	Disabled        bool   `json:"disabled"`
+	Name            string             `json:"name"`
+	Type            string             `json:"type,omitempty"`
+	Database        string             `json:"database,omitempty"`
+	Query           string             `json:"query"`
+	Key             []string           `json:"key,omitempty"`
+	Cursor          string             `json:"cursor,omitempty"`
+	Interval        string             `json:"interval,omitempty"`
+	Cron            string             `json:"cron,omitempty"`
+	Timeout         string             `json:"timeout,omitempty"`
+	Threshold       *ThresholdConfig   `json:"threshold,omitempty"`
+	Window          string             `json:"window,omitempty"`
+	Severity        string             `json:"severity,omitempty"`
+	Message         string             `json:"message,omitempty"`
+	ResolvedMessage string             `json:"resolvedMessage,omitempty"`
+	Tags            []string           `json:"tags,omitempty"`
+	Targets         []string           `json:"targets,omitempty"`
+	RateLimit       *RateLimitConfig   `json:"rateLimit,omitempty"`
+	Cooldown        string             `json:"cooldown,omitempty"`
+	Digest          string             `json:"digest,omitempty"`
+	QuietHours      []QuietHoursConfig `json:"quietHours,omitempty"`
+	TargetConfig
+	Disabled bool `json:"disabled"`
+}
+
+// TargetConfig is where and how notifications are sent. Queries have these settings inline
+// as their own target, named targets of config have the same format.
+type TargetConfig struct {
+	Notifier            string         `json:"notifier,omitempty"`
+	NotificationURL     string         `json:"notificationUrl"`
+	TelegramChatID      string         `json:"telegramChatId,omitempty"`
+	EmailTo             []string       `json:"emailTo,omitempty"`
+	PagerDutyRoutingKey string         `json:"pagerDutyRoutingKey,omitempty"`
+	Webhook             *WebhookConfig `json:"webhook,omitempty"`
+	Ntfy                *NtfyConfig    `json:"ntfy,omitempty"`
+}
+
+// NamedTarget is a target in targets section of config. Only named targets have own rate limit,
+// the one of a query limits all its notifications.
+type NamedTarget struct {
+	TargetConfig
+	RateLimit *RateLimitConfig `json:"rateLimit,omitempty"`
+}
+
+// RateLimitConfig allows Count notifications per Per duration ("1h").
+type RateLimitConfig struct {
+	Count int    `json:"count"`
+	Per   string `json:"per"`
+}
+
+// QuietHoursConfig is a daily period when notifications of a query are dropped or deferred
+// (SuppressDrop or SuppressDefer, the default). From and To are "15:04" times in Timezone,
+// local one by default, a period ending before its start goes over midnight. Days ("mon",
+// "tue", ...) limit the period to some weekdays, it belongs to the day it starts.
+type QuietHoursConfig struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Days     []string `json:"days,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+	Action   string   `json:"action,omitempty"`
+}
+
+// RouteConfig adds targets to notifications of matching queries. A route matches queries
+// having any of Tags, one of Severity and at least MinRows rows, empty conditions match any query.
+type RouteConfig struct {
+	Tags     []string `json:"tags,omitempty"`
+	Severity []string `json:"severity,omitempty"`
+	MinRows  int      `json:"minRows,omitempty"`
+	Targets  []string `json:"targets"`
+}
+
+// TelegramConfig is the bot used by telegram notifiers, APIURL is only needed for a self-hosted Bot API server.
+type TelegramConfig struct {
+	BotToken string `json:"botToken"`
+	ChatID   string `json:"chatId"`
+	APIURL   string `json:"apiUrl,omitempty"`
+}
+
+// SMTPConfig is the mail server used by email notifiers, TLS is one of SMTPStartTLS, SMTPTLS or SMTPNone.
+type SMTPConfig struct {
+	Host     string `json:"host"`
+	Port     string `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from"`
+	TLS      string `json:"tls,omitempty"`
+}
+
+// PagerDutyConfig is the Events API v2 integration, EventsURL is only needed for the EU service region.
+type PagerDutyConfig struct {
+	RoutingKey string `json:"routingKey"`
+	EventsURL  string `json:"eventsUrl,omitempty"`
+}
+
+// OpsgenieConfig is the API integration key, APIURL is only needed for the EU instance.
+type OpsgenieConfig struct {
+	APIKey string `json:"apiKey"`
+	APIURL string `json:"apiUrl,omitempty"`
+}
+
+// WebhookConfig describes the request of a webhook notifier, method, header values and body are templates.
+type WebhookConfig struct {
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// NtfyConfig sets ntfy message options, all texts are templates. Token is used for bearer
+// auth, Username and Password for basic one. JSON publishes in JSON format instead of headers.
+type NtfyConfig struct {
+	Title    string       `json:"title,omitempty"`
+	Priority string       `json:"priority,omitempty"`
+	Tags     []string     `json:"tags,omitempty"`
+	Click    string       `json:"click,omitempty"`
+	Actions  []NtfyAction `json:"actions,omitempty"`
+	Token    string       `json:"token,omitempty"`
+	Username string       `json:"username,omitempty"`
+	Password string       `json:"password,omitempty"`
+	JSON     bool         `json:"json,omitempty"`
+}
+
+// NtfyAction is a button of ntfy notification: "view" opens URL, "http" sends a request.
+type NtfyAction struct {
+	Action  string            `json:"action"`
+	Label   string            `json:"label"`
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Clear   bool              `json:"clear,omitempty"`
+}
+
+type ThresholdConfig struct {
+	Operator string  `json:"operator"`
+	Value    float64 `json:"value"`
 }
 
 func NewDefaultConfig() Config {
 	return Config{
-		Database: DatabaseConfig{
-			Username: "",
-			Password: "",
-			Host:     "",
-			Port:     "",
-			Name:     "",
+		Databases: map[string]DatabaseConfig{
+			DefaultDatabaseName: {
+				Driver:   DriverMySQL,
+				Username: "",
+				Password: "",
+				Host:     "",
+				Port:     "",
+				Name:     "",
+			},
 		},
 		Queries: []QueryConfig{
 			{
-				Name:            "Query 1",
-				Query:           "SELECT id FROM table",
-				NotificationURL: "https://ntfy.sh/sqlal",
-				Disabled:        false,
+				Name:         "Query 1",
+				Database:     DefaultDatabaseName,
+				Query:        "SELECT id FROM table",
+				TargetConfig: TargetConfig{NotificationURL: "https://ntfy.sh/sqlal"},
+				Disabled:     false,
 			},
 		},
 		BaseNotificationURL:  "https://ntfy.sh/sqlal",
@@ -88,6 +281,15 @@ func (c *Config) GetQueryNames() []string {
 	return names
 }
 
+func (c *Config) QueryByName(name string) (QueryConfig, bool) {
+	for _, query := range c.Queries {
+		if query.Name == name {
+			return query, true
+		}
+	}
+	return QueryConfig{}, false
+}
+
 func (c *Config) AddQuery(newQuery QueryConfig) {
 	c.Queries = append(c.Queries, newQuery)
 }
@@ -106,8 +308,39 @@ func (c *Config) DeleteQueryByIndex(index int) {
 	c.Queries = append(c.Queries[:index], c.Queries[index+1:]...)
 }
 
-func (c *Config) UpdateDB(newDB DatabaseConfig) {
-	c.Database = newDB
+func (c *Config) GetDatabaseNames() []string {
+	var names []string
+
+	for name := range c.Databases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// QueryDatabase resolves the connection name a query runs against.
+// Queries without explicit database use "default" or the only configured connection.
+func (c *Config) QueryDatabase(query QueryConfig) (string, error) {
+	name := query.Database
+	if name == "" {
+		if _, ok := c.Databases[DefaultDatabaseName]; ok || len(c.Databases) != 1 {
+			name = DefaultDatabaseName
+		} else {
+			name = c.GetDatabaseNames()[0]
+		}
+	}
+
+	if _, ok := c.Databases[name]; !ok {
+		return "", fmt.Errorf("unknown database connection %q for query %s", name, query.Name)
+	}
+	return name, nil
+}
+
+func (c *Config) UpdateDB(name string, newDB DatabaseConfig) {
+	if c.Databases == nil {
+		c.Databases = map[string]DatabaseConfig{}
+	}
+	c.Databases[name] = newDB
 }
 
 func (c *Config) UpdateSettings(newSettings *Config) {
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestQueryDatabase(t *testing.T) {
+	tests := []struct {
+		name      string
+		databases []string
+		query     QueryConfig
+		want      string
+		wantErr   bool
+	}{
+		{"explicit", []string{DefaultDatabaseName, "reports"}, QueryConfig{Database: "reports"}, "reports", false},
+		{"default", []string{DefaultDatabaseName, "reports"}, QueryConfig{}, DefaultDatabaseName, false},
+		{"only connection", []string{"reports"}, QueryConfig{}, "reports", false},
+		{"no default among many", []string{"billing", "reports"}, QueryConfig{}, "", true},
+		{"unknown", []string{DefaultDatabaseName}, QueryConfig{Database: "reports"}, "", true},
+		{"no connections", nil, QueryConfig{}, "", true},
+	}
+	for _, tt := range tests {
+		config := Config{Databases: map[string]DatabaseConfig{}}
+		for _, name := range tt.databases {
+			config.Databases[name] = DatabaseConfig{Driver: "sqlite", Path: name + ".db"}
+		}
+		tt.query.Name = "orders"
+
+		got, err := config.QueryDatabase(tt.query)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "orders") {
+				t.Errorf("%s: err = %v, want an error naming the query", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: database = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestConfigLegacyDatabase(t *testing.T) {
+	var config Config
+	data := `{"database": {"driver": "postgres", "host": "db.example.com", "name": "shop"}}`
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+	db, ok := config.Databases[DefaultDatabaseName]
+	if len(config.Databases) != 1 || !ok {
+		t.Fatalf("databases = %v, want the legacy section as %q", config.Databases, DefaultDatabaseName)
+	}
+	if db.Driver != "postgres" || db.Host != "db.example.com" || db.Name != "shop" {
+		t.Errorf("database = %+v", db)
+	}
+
+	// The named connections win over the legacy section when both are present
+	config = Config{}
+	data = `{"database": {"driver": "postgres"}, "databases": {"reports": {"driver": "mysql"}}}`
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.Databases[DefaultDatabaseName]; ok || config.Databases["reports"].Driver != "mysql" {
+		t.Errorf("databases = %v, want only reports", config.Databases)
+	}
+
+	// Saving writes the named form only
+	out, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), `"database":`) {
+		t.Errorf("marshalled config has the legacy section: %s", out)
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ResultDiff is the difference between the previous and the current result of a diff query.
+type ResultDiff struct {
+	Added   []Row
+	Removed []Row
+	Changed []Row
+}
+
+func (d ResultDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String lists row keys prefixed with + for appeared, - for disappeared and ~ for changed rows.
+func (d ResultDiff) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%d appeared, %d disappeared, %d changed", len(d.Added), len(d.Removed), len(d.Changed))
+	for _, group := range []struct {
+		sign string
+		rows []Row
+	}{{"+", d.Added}, {"-", d.Removed}, {"~", d.Changed}} {
+		for _, row := range group.rows {
+			fmt.Fprintf(&b, "\n%s %s", group.sign, row.Key)
+		}
+	}
+	return b.String()
+}
+
+// Fingerprint identifies row values, rows with the same key and fingerprint are unchanged.
+func Fingerprint(row Row) string {
+	// json.Marshal sorts map keys, so equal values always give the same hash
+	data, _ := json.Marshal(row.Values)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func DiffRows(previous map[string]Row, current []Row) ResultDiff {
+	var diff ResultDiff
+
+	seen := make(map[string]bool, len(current))
+	for _, row := range current {
+		seen[row.Key] = true
+
+		old, ok := previous[row.Key]
+		if !ok {
+			diff.Added = append(diff.Added, row)
+		} else if Fingerprint(old) != Fingerprint(row) {
+			diff.Changed = append(diff.Changed, row)
+		}
+	}
+
+	for key, row := range previous {
+		if !seen[key] {
+			diff.Removed = append(diff.Removed, row)
+		}
+	}
+	sort.Slice(diff.Removed, func(i, j int) bool {
+		return diff.Removed[i].Key < diff.Removed[j].Key
+	})
+	return diff
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func row(key string, values ...string) Row {
+	r := Row{Key: key, Values: map[string]string{"id": key}}
+	for i := 0; i+1 < len(values); i += 2 {
+		r.Values[values[i]] = values[i+1]
+	}
+	return r
+}
+
+func rowKeys(rows []Row) []string {
+	var keys []string
+	for _, r := range rows {
+		keys = append(keys, r.Key)
+	}
+	return keys
+}
+
+func TestDiffRows(t *testing.T) {
+	snapshot := func(rows ...Row) map[string]Row {
+		m := make(map[string]Row)
+		for _, r := range rows {
+			m[r.Key] = r
+		}
+		return m
+	}
+
+	tests := []struct {
+		name                    string
+		previous                map[string]Row
+		current                 []Row
+		added, removed, changed []string
+	}{
+		{
+			name:     "unchanged",
+			previous: snapshot(row("a", "state", "stuck")),
+			current:  []Row{row("a", "state", "stuck")},
+		},
+		{
+			name:     "appeared",
+			previous: snapshot(row("a")),
+			current:  []Row{row("a"), row("b")},
+			added:    []string{"b"},
+		},
+		{
+			name:     "disappeared sorted",
+			previous: snapshot(row("c"), row("a"), row("b")),
+			current:  []Row{row("b")},
+			removed:  []string{"a", "c"},
+		},
+		{
+			name:     "changed",
+			previous: snapshot(row("a", "state", "stuck"), row("b", "state", "ok")),
+			current:  []Row{row("a", "state", "failed"), row("b", "state", "ok")},
+			changed:  []string{"a"},
+		},
+		{
+			name:     "empty previous",
+			previous: snapshot(),
+			current:  []Row{row("a")},
+			added:    []string{"a"},
+		},
+		{
+			name:     "empty current",
+			previous: snapshot(row("a")),
+			removed:  []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := DiffRows(tt.previous, tt.current)
+			if got := rowKeys(diff.Added); !reflect.DeepEqual(got, tt.added) {
+				t.Errorf("added = %v, want %v", got, tt.added)
+			}
+			if got := rowKeys(diff.Removed); !reflect.DeepEqual(got, tt.removed) {
+				t.Errorf("removed = %v, want %v", got, tt.removed)
+			}
+			if got := rowKeys(diff.Changed); !reflect.DeepEqual(got, tt.changed) {
+				t.Errorf("changed = %v, want %v", got, tt.changed)
+			}
+			if empty := tt.added == nil && tt.removed == nil && tt.changed == nil; diff.Empty() != empty {
+				t.Errorf("Empty() = %v, want %v", diff.Empty(), empty)
+			}
+		})
+	}
+}
+
+func TestResultDiffString(t *testing.T) {
+	diff := ResultDiff{Added: []Row{row("a")}, Removed: []Row{row("b")}, Changed: []Row{row("c")}}
+	want := "1 appeared, 1 disappeared, 1 changed\n+ a\n- b\n~ c"
+	if got := diff.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
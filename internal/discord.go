@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Discord embed limits
+const (
+	discordDescriptionLimit = 4096
+	discordFieldLimit       = 1024
+)
+
+// Embed colors by alert status, new rows and diffs are blue
+const (
+	discordColorFiring   = 0xE01E5A
+	discordColorResolved = 0x2EB67D
+	discordColorDefault  = 0x3B82F6
+)
+
+type discordNotifier struct {
+	url string
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+	Timestamp   string         `json:"timestamp,omitempty"`
+}
+
+type discordMessage struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+// Notify posts an embed to a Discord webhook: query name as title, the message,
+// rows count, status and a table of rows.
+func (d discordNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(discordPayload(n))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Webhooks answer 204 unless called with ?wait=true
+	return doRequest(req, http.StatusOK, http.StatusNoContent)
+}
+
+func discordPayload(n Notification) discordMessage {
+	embed := discordEmbed{
+		Title:       truncate(n.Query, 256),
+		Description: truncate(n.Message, discordDescriptionLimit),
+		Color:       discordColorDefault,
+		Fields:      []discordField{{Name: "Rows", Value: fmt.Sprint(len(n.Rows)), Inline: true}},
+	}
+	if !n.Time.IsZero() {
+		embed.Timestamp = n.Time.Format(time.RFC3339)
+	}
+
+	if n.Status != "" {
+		embed.Fields = append(embed.Fields, discordField{Name: "Status", Value: n.Status, Inline: true})
+		embed.Color = discordColorFiring
+		if n.Status == AlertResolved {
+			embed.Color = discordColorResolved
+		}
+	}
+	if len(n.Rows) > 0 && len(n.Columns) > 0 {
+		table := truncate(textTable(n.Columns, n.Rows), discordFieldLimit-8)
+		embed.Fields = append(embed.Fields, discordField{Name: "Data", Value: "```\n" + table + "\n```"})
+	}
+
+	return discordMessage{Embeds: []discordEmbed{embed}}
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDiscordNotify(t *testing.T) {
+	server, requests := recordServer(t, http.StatusNoContent)
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierDiscord, NotificationURL: server.URL + "/api/webhooks/1/x"}}
+
+	tests := []struct {
+		status    string
+		wantColor int
+		wantField []string
+	}{
+		{"", discordColorDefault, []string{"Rows", "Data"}},
+		{AlertFiring, discordColorFiring, []string{"Rows", "Status", "Data"}},
+		{AlertResolved, discordColorResolved, []string{"Rows", "Status", "Data"}},
+	}
+	for i, tt := range tests {
+		n := testNotification()
+		n.Status = tt.status
+		if err := notify(t, &Config{}, query, n); err != nil {
+			t.Fatal(err)
+		}
+
+		got := requests()[i]
+		if got.Path != "/api/webhooks/1/x" || got.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("%q: request %s with Content-Type %q", tt.status, got.Path, got.Header.Get("Content-Type"))
+		}
+		var message discordMessage
+		if err := json.Unmarshal([]byte(got.Body), &message); err != nil {
+			t.Fatal(err)
+		}
+		if len(message.Embeds) != 1 {
+			t.Fatalf("%q: got %d embeds, want 1", tt.status, len(message.Embeds))
+		}
+		embed := message.Embeds[0]
+		if embed.Title != "orders" || embed.Description != n.Message || embed.Timestamp != "2024-05-01T10:00:00Z" {
+			t.Errorf("%q: embed = %+v", tt.status, embed)
+		}
+		if embed.Color != tt.wantColor {
+			t.Errorf("%q: color = %#x, want %#x", tt.status, embed.Color, tt.wantColor)
+		}
+
+		var names []string
+		for _, field := range embed.Fields {
+			names = append(names, field.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.wantField, ",") {
+			t.Fatalf("%q: fields %v, want %v", tt.status, names, tt.wantField)
+		}
+		if embed.Fields[0].Value != "2" {
+			t.Errorf("%q: rows field = %q", tt.status, embed.Fields[0].Value)
+		}
+		if tt.status != "" && embed.Fields[1].Value != tt.status {
+			t.Errorf("%q: status field = %q", tt.status, embed.Fields[1].Value)
+		}
+		if data := embed.Fields[len(embed.Fields)-1].Value; !strings.HasPrefix(data, "```\n") || !strings.Contains(data, "a@example.com") {
+			t.Errorf("%q: data field = %q", tt.status, data)
+		}
+	}
+}
+
+func TestDiscordPayloadLimits(t *testing.T) {
+	n := testNotification()
+	n.Message = strings.Repeat("x", 5000)
+	n.Rows = nil
+	for i := 0; i < 100; i++ {
+		n.Rows = append(n.Rows, map[string]string{"id": strings.Repeat("9", 20), "email": "someone@example.com"})
+	}
+
+	embed := discordPayload(n).Embeds[0]
+	if l := len([]rune(embed.Description)); l > discordDescriptionLimit {
+		t.Errorf("description has %d characters, limit is %d", l, discordDescriptionLimit)
+	}
+	data := embed.Fields[len(embed.Fields)-1]
+	if l := len([]rune(data.Value)); l > discordFieldLimit {
+		t.Errorf("data field has %d characters, limit is %d", l, discordFieldLimit)
+	}
+	if !strings.HasSuffix(data.Value, "\n```") {
+		t.Errorf("truncated table is not closed: %q", data.Value[len(data.Value)-10:])
+	}
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+
+	"github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Driver hides the differences between the supported database engines.
+type Driver interface {
+	// SQLName is the name the driver is registered with in database/sql.
+	SQLName() string
+	// DSN builds a connection string from the database configuration.
+	DSN(db DatabaseConfig) (string, error)
+}
+
+var drivers = map[string]Driver{
+	DriverMySQL:    mysqlDriver{},
+	DriverPostgres: postgresDriver{},
+	DriverSQLite:   sqliteDriver{},
+}
+
+func GetDriver(name string) (Driver, error) {
+	if name == "" {
+		name = DriverMySQL
+	}
+
+	driver, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver: %s", name)
+	}
+	return driver, nil
+}
+
+func DriverNames() []string {
+	var names []string
+
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func OpenDatabase(db DatabaseConfig) (*sql.DB, error) {
+	driver, err := GetDriver(db.Driver)
+	if err != nil {
+		return nil, err
+	}
+
+	dsn, err := driver.DSN(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.Open(driver.SQLName(), dsn)
+}
+
+func requireNetworkFields(db DatabaseConfig) error {
+	if db.Host == "" {
+		return fmt.Errorf("database host is required for %s", db.Driver)
+	}
+	if db.Name == "" {
+		return fmt.Errorf("database name is required for %s", db.Driver)
+	}
+	return nil
+}
+
+type mysqlDriver struct{}
+
+func (mysqlDriver) SQLName() string {
+	return "mysql"
+}
+
+func (mysqlDriver) DSN(db DatabaseConfig) (string, error) {
+	if err := requireNetworkFields(db); err != nil {
+		return "", err
+	}
+
+	port := db.Port
+	if port == "" {
+		port = "3306"
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.User = db.Username
+	cfg.Passwd = db.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(db.Host, port)
+	cfg.DBName = db.Name
+	cfg.ParseTime = true
+	return cfg.FormatDSN(), nil
+}
+
+type postgresDriver struct{}
+
+func (postgresDriver) SQLName() string {
+	return "postgres"
+}
+
+func (postgresDriver) DSN(db DatabaseConfig) (string, error) {
+	if err := requireNetworkFields(db); err != nil {
+		return "", err
+	}
+
+	port := db.Port
+	if port == "" {
+		port = "5432"
+	}
+
+	dsn := url.URL{
+		Scheme: "postgres",
+		Host:   net.JoinHostPort(db.Host, port),
+		Path:   "/" + db.Name,
+	}
+	if db.Username != "" {
+		dsn.User = url.UserPassword(db.Username, db.Password)
+	}
+	if db.SSLMode != "" {
+		dsn.RawQuery = url.Values{"sslmode": {db.SSLMode}}.Encode()
+	}
+	return dsn.String(), nil
+}
+
+type sqliteDriver struct{}
+
+func (sqliteDriver) SQLName() string {
+	return "sqlite"
+}
+
+func (sqliteDriver) DSN(db DatabaseConfig) (string, error) {
+	if db.Path == "" {
+		return "", fmt.Errorf("database path is required for %s", db.Driver)
+	}
+	if _, err := os.Stat(db.Path); err != nil {
+		return "", fmt.Errorf("sqlite database %s: %w", db.Path, err)
+	}
+
+	// Watched databases belong to other services, so open them read-only
+	// and wait for their writers instead of failing with SQLITE_BUSY.
+	dsn := url.URL{
+		Scheme:   "file",
+		Opaque:   db.Path,
+		RawQuery: "mode=ro&_pragma=busy_timeout(5000)",
+	}
+	return dsn.String(), nil
+}
+
+// UsesPath reports whether the driver connects to a local file instead of a server.
+func (db DatabaseConfig) UsesPath() bool {
+	return db.Driver == DriverSQLite
+}
@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDSN(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		db      DatabaseConfig
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "mysql default port",
+			db:   DatabaseConfig{Username: "app", Password: "secret", Host: "db", Name: "shop"},
+			want: "app:secret@tcp(db:3306)/shop?parseTime=true",
+		},
+		{
+			name: "mysql explicit port",
+			db:   DatabaseConfig{Driver: DriverMySQL, Username: "app", Host: "db", Port: "3307", Name: "shop"},
+			want: "app@tcp(db:3307)/shop?parseTime=true",
+		},
+		{
+			name: "postgres",
+			db:   DatabaseConfig{Driver: DriverPostgres, Username: "app", Password: "p@ss word", Host: "db", Name: "shop", SSLMode: "disable"},
+			want: "postgres://app:p%40ss%20word@db:5432/shop?sslmode=disable",
+		},
+		{
+			name: "postgres without user",
+			db:   DatabaseConfig{Driver: DriverPostgres, Host: "::1", Port: "6432", Name: "shop"},
+			want: "postgres://[::1]:6432/shop",
+		},
+		{
+			name: "sqlite",
+			db:   DatabaseConfig{Driver: DriverSQLite, Path: path},
+			want: "file:" + path + "?mode=ro&_pragma=busy_timeout(5000)",
+		},
+		{name: "mysql without host", db: DatabaseConfig{Name: "shop"}, wantErr: true},
+		{name: "postgres without name", db: DatabaseConfig{Driver: DriverPostgres, Host: "db"}, wantErr: true},
+		{name: "sqlite without path", db: DatabaseConfig{Driver: DriverSQLite}, wantErr: true},
+		{name: "sqlite missing file", db: DatabaseConfig{Driver: DriverSQLite, Path: path + ".missing"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			driver, err := GetDriver(tt.db.Driver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := driver.DSN(tt.db)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("DSN() = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("DSN() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDriverUnknown(t *testing.T) {
+	if _, err := GetDriver("oracle"); err == nil {
+		t.Error("GetDriver(oracle) succeeded, want error")
+	}
+}
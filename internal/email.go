@@ -0,0 +1,282 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTP connection security: STARTTLS upgrade, implicit TLS (usually port 465) or plain text.
+const (
+	SMTPStartTLS = "starttls"
+	SMTPTLS      = "tls"
+	SMTPNone     = "none"
+)
+
+const (
+	// Emails are kept for audit, so they list much more rows than chat messages
+	maxEmailRows = 1000
+	smtpTimeout  = 30 * time.Second
+)
+
+var emailTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h3>{{.Query}}{{if .Status}} ({{.Status}}){{end}}</h3>
+<p style="white-space: pre-wrap">{{.Message}}</p>
+{{- if and .Columns .Rows}}
+<table border="1" cellpadding="4" cellspacing="0" style="border-collapse: collapse">
+<tr>{{range .Columns}}<th>{{.}}</th>{{end}}</tr>
+{{- range .Rows}}{{$row := .}}
+<tr>{{range $.Columns}}<td>{{index $row .}}</td>{{end}}</tr>
+{{- end}}
+</table>
+{{- if .More}}
+<p>... and {{.More}} more</p>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+type emailNotifier struct {
+	host     string
+	port     string
+	security string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func newEmailNotifier(config *Config, query QueryConfig) (Notifier, error) {
+	if config.SMTP == nil || config.SMTP.Host == "" || config.SMTP.From == "" {
+		return nil, fmt.Errorf("email notifier of query %s needs smtp host and from", query.Name)
+	}
+	if len(query.EmailTo) == 0 {
+		return nil, fmt.Errorf("email notifier of query %s needs emailTo", query.Name)
+	}
+
+	smtpConfig := *config.SMTP
+	security := smtpConfig.TLS
+	if security == "" && smtpConfig.Port == "465" {
+		security = SMTPTLS
+	}
+
+	port := smtpConfig.Port
+	switch security {
+	case "", SMTPStartTLS:
+		if port == "" {
+			port = "587"
+		}
+	case SMTPTLS:
+		if port == "" {
+			port = "465"
+		}
+	case SMTPNone:
+		if port == "" {
+			port = "25"
+		}
+	default:
+		return nil, fmt.Errorf("unknown smtp tls mode %q", smtpConfig.TLS)
+	}
+
+	return emailNotifier{
+		host:     smtpConfig.Host,
+		port:     port,
+		security: security,
+		username: smtpConfig.Username,
+		password: smtpConfig.Password,
+		from:     smtpConfig.From,
+		to:       query.EmailTo,
+	}, nil
+}
+
+// Notify mails rows as an HTML table with a plain text alternative.
+func (e emailNotifier) Notify(ctx context.Context, n Notification) error {
+	from, err := mail.ParseAddress(e.from)
+	if err != nil {
+		return fmt.Errorf("invalid smtp from: %w", err)
+	}
+	var recipients []string
+	for _, to := range e.to {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("invalid email recipient: %w", err)
+		}
+		recipients = append(recipients, address.Address)
+	}
+
+	message, err := emailMessage(e.from, e.to, n)
+	if err != nil {
+		return err
+	}
+
+	client, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if e.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// dial connects to the server and secures the connection according to the tls mode,
+// without explicit mode STARTTLS is used when the server offers it.
+func (e emailNotifier) dial(ctx context.Context) (*smtp.Client, error) {
+	address := net.JoinHostPort(e.host, e.port)
+	tlsConfig := &tls.Config{ServerName: e.host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	var err error
+	if e.security == SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(smtpTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if e.security == "" || e.security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			err = client.StartTLS(tlsConfig)
+		} else if e.security == SMTPStartTLS {
+			err = fmt.Errorf("smtp server %s doesn't support STARTTLS", address)
+		}
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
+
+// emailMessage builds a multipart/alternative message with quoted-printable text and HTML parts.
+func emailMessage(from string, to []string, n Notification) ([]byte, error) {
+	shown := n.Rows
+	if len(shown) > maxEmailRows {
+		shown = shown[:maxEmailRows]
+	}
+
+	var html bytes.Buffer
+	err := emailTemplate.Execute(&html, struct {
+		Notification
+		More int
+	}{
+		Notification: Notification{Query: n.Query, Message: n.Message, Status: n.Status, Columns: n.Columns, Rows: shown},
+		More:         len(n.Rows) - len(shown),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	text := n.Message
+	if len(n.Rows) > 0 && len(n.Columns) > 0 {
+		text += "\n\n" + textTableLimit(n.Columns, n.Rows, maxEmailRows)
+	}
+
+	subject := "[sqlal] " + n.Query
+	if n.Status != "" {
+		subject += " " + n.Status
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{{"text/plain", text}, {"text/html", html.String()}} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	headers := [][2]string{
+		{"From", from},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", n.Time.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	}
+	if n.ID != "" {
+		// Retries keep the Message-ID, so mail servers and clients may drop duplicates
+		headers = append(headers, [2]string{"Message-ID", "<" + n.ID + "@sqlal>"})
+	}
+
+	var message bytes.Buffer
+	for _, header := range headers {
+		fmt.Fprintf(&message, "%s: %s\r\n", header[0], header[1])
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(content, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
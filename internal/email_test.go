@@ -0,0 +1,267 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// smtpSink is a local SMTP server which accepts any mail and keeps it.
+type smtpSink struct {
+	listener net.Listener
+	auth     bool
+
+	mu       sync.Mutex
+	from     string
+	to       []string
+	data     string
+	authUser string
+}
+
+func newSMTPSink(t *testing.T, auth bool) *smtpSink {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &smtpSink{listener: listener, auth: auth}
+	t.Cleanup(func() { listener.Close() })
+	go sink.serve()
+	return sink
+}
+
+func (s *smtpSink) port() string {
+	return fmt.Sprint(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(conn)
+	}
+}
+
+func (s *smtpSink) session(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 sink ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch command {
+		case "EHLO", "HELO":
+			if s.auth {
+				reply("250-sink")
+				reply("250 AUTH PLAIN")
+			} else {
+				reply("250 sink")
+			}
+		case "AUTH":
+			fields := strings.Fields(line)
+			decoded, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			parts := strings.Split(string(decoded), "\x00")
+			s.mu.Lock()
+			s.authUser = parts[1] + ":" + parts[2]
+			s.mu.Unlock()
+			reply("235 ok")
+		case "MAIL":
+			s.mu.Lock()
+			s.from = strings.Trim(strings.TrimPrefix(line[5:], "FROM:"), "<> ")
+			s.mu.Unlock()
+			reply("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.to = append(s.to, strings.Trim(strings.TrimPrefix(line[5:], "TO:"), "<> "))
+			s.mu.Unlock()
+			reply("250 ok")
+		case "DATA":
+			reply("354 go on")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+// emailParts returns decoded text and HTML parts of the message.
+func emailParts(t *testing.T, message *mail.Message) (string, string) {
+	t.Helper()
+	_, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := map[string]string{}
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[mediaType] = string(content)
+	}
+	return parts["text/plain"], parts["text/html"]
+}
+
+func TestEmailNotify(t *testing.T) {
+	sink := newSMTPSink(t, true)
+	config := &Config{SMTP: &SMTPConfig{Host: "127.0.0.1", Port: sink.port(), Username: "bot", Password: "secret", From: "sqlal <alerts@example.com>"}}
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierEmail, EmailTo: []string{"Ops <ops@example.com>", "dev@example.com"}}}
+
+	n := testNotification()
+	n.Status = AlertFiring
+	if err := notify(t, config, query, n); err != nil {
+		t.Fatal(err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if sink.authUser != "bot:secret" {
+		t.Errorf("auth = %q", sink.authUser)
+	}
+	if sink.from != "alerts@example.com" || strings.Join(sink.to, ",") != "ops@example.com,dev@example.com" {
+		t.Errorf("envelope from %q to %v", sink.from, sink.to)
+	}
+
+	message, err := mail.ReadMessage(strings.NewReader(sink.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject := message.Header.Get("Subject"); subject != "[sqlal] orders firing" {
+		t.Errorf("Subject = %q", subject)
+	}
+	if id := message.Header.Get("Message-ID"); id != "<"+n.ID+"@sqlal>" {
+		t.Errorf("Message-ID = %q", id)
+	}
+
+	text, html := emailParts(t, message)
+	if !strings.HasPrefix(text, n.Message) || !strings.Contains(text, "b@example.com") {
+		t.Errorf("text part = %q", text)
+	}
+	if !strings.Contains(html, "<td>b@example.com</td>") || !strings.Contains(html, "orders: 2 new &lt;rows&gt;") {
+		t.Errorf("html part = %q", html)
+	}
+}
+
+func TestEmailStartTLSRequired(t *testing.T) {
+	sink := newSMTPSink(t, false)
+	config := &Config{SMTP: &SMTPConfig{Host: "127.0.0.1", Port: sink.port(), From: "alerts@example.com", TLS: SMTPStartTLS}}
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierEmail, EmailTo: []string{"ops@example.com"}}}
+
+	notifier, err := NewNotifier(config, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := notifier.(emailNotifier).dial(context.Background()); err == nil {
+		t.Error("dial() without STARTTLS support succeeded in starttls mode")
+	}
+
+	// Without explicit mode plain connections are fine when the server doesn't offer STARTTLS
+	config.SMTP.TLS = ""
+	if err := notify(t, config, query, testNotification()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEmailMessageRowLimit(t *testing.T) {
+	n := testNotification()
+	n.Rows = nil
+	for i := 0; i < maxEmailRows+5; i++ {
+		n.Rows = append(n.Rows, map[string]string{"id": fmt.Sprint(i), "email": "x@example.com"})
+	}
+
+	data, err := emailMessage("alerts@example.com", []string{"ops@example.com"}, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, err := mail.ReadMessage(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, html := emailParts(t, message)
+	if got := strings.Count(html, "<tr>") - 1; got != maxEmailRows {
+		t.Errorf("html has %d rows, want %d", got, maxEmailRows)
+	}
+	if !strings.Contains(html, "... and 5 more") {
+		t.Error("html doesn't tell about rows over the limit")
+	}
+}
+
+func TestNewEmailNotifier(t *testing.T) {
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierEmail, EmailTo: []string{"ops@example.com"}}}
+	tests := []struct {
+		smtp     SMTPConfig
+		port     string
+		security string
+	}{
+		{SMTPConfig{Host: "mail", From: "a@example.com"}, "587", ""},
+		{SMTPConfig{Host: "mail", From: "a@example.com", Port: "465"}, "465", SMTPTLS},
+		{SMTPConfig{Host: "mail", From: "a@example.com", TLS: SMTPTLS}, "465", SMTPTLS},
+		{SMTPConfig{Host: "mail", From: "a@example.com", TLS: SMTPNone}, "25", SMTPNone},
+	}
+	for _, tt := range tests {
+		notifier, err := NewNotifier(&Config{SMTP: &tt.smtp}, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := notifier.(emailNotifier)
+		if e.port != tt.port || e.security != tt.security {
+			t.Errorf("%+v: port %s security %q, want %s %q", tt.smtp, e.port, e.security, tt.port, tt.security)
+		}
+	}
+
+	for _, config := range []*Config{
+		{},
+		{SMTP: &SMTPConfig{Host: "mail"}},
+		{SMTP: &SMTPConfig{Host: "mail", From: "a@example.com", TLS: "ssl"}},
+	} {
+		if _, err := NewNotifier(config, query); err == nil {
+			t.Errorf("email notifier with %+v was built", config.SMTP)
+		}
+	}
+}
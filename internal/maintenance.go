@@ -0,0 +1,182 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Actions of quiet hours and maintenance windows: drop forgets notifications,
+// defer keeps them in the outbox until the window ends.
+const (
+	SuppressDrop  = "drop"
+	SuppressDefer = "defer"
+)
+
+// Suppression is an active quiet period or maintenance window of a query.
+type Suppression struct {
+	Reason string
+	Action string
+	Until  time.Time
+}
+
+// MaintenanceWindow suppresses notifications of a query, or of all queries when Query is empty, until EndsAt.
+type MaintenanceWindow struct {
+	ID       int64
+	Query    string
+	Action   string
+	Reason   string
+	StartsAt time.Time
+	EndsAt   time.Time
+}
+
+func (m MaintenanceWindow) covers(query string) bool {
+	return m.Query == "" || m.Query == query
+}
+
+// Until returns the end of the quiet period the given time is in, zero time outside of it.
+func (q QuietHoursConfig) Until(at time.Time) (time.Time, error) {
+	location := time.Local
+	if q.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(q.Timezone); err != nil {
+			return time.Time{}, fmt.Errorf("invalid quiet hours timezone: %w", err)
+		}
+	}
+	from, err := time.Parse("15:04", q.From)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid quiet hours start %q", q.From)
+	}
+	to, err := time.Parse("15:04", q.To)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid quiet hours end %q", q.To)
+	}
+	for _, day := range q.Days {
+		if !slices.Contains(weekdays, strings.ToLower(day)) {
+			return time.Time{}, fmt.Errorf("invalid quiet hours day %q", day)
+		}
+	}
+	switch q.Action {
+	case "", SuppressDrop, SuppressDefer:
+	default:
+		return time.Time{}, fmt.Errorf("unknown quiet hours action %q", q.Action)
+	}
+
+	// The period started either today or, going over midnight, yesterday
+	local := at.In(location)
+	for _, offset := range []int{0, -1} {
+		day := local.AddDate(0, 0, offset)
+		if len(q.Days) > 0 && !slices.ContainsFunc(q.Days, func(d string) bool {
+			return strings.ToLower(d) == weekdays[day.Weekday()]
+		}) {
+			continue
+		}
+
+		start := time.Date(day.Year(), day.Month(), day.Day(), from.Hour(), from.Minute(), 0, 0, location)
+		end := time.Date(day.Year(), day.Month(), day.Day(), to.Hour(), to.Minute(), 0, 0, location)
+		if !end.After(start) {
+			end = end.AddDate(0, 0, 1)
+		}
+		if !local.Before(start) && local.Before(end) {
+			return end.In(at.Location()), nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// QuerySuppression returns the active quiet period or maintenance window of the query, nil when
+// notifications may be sent. When several are active, drop wins and the latest end is reported.
+func (c *Config) QuerySuppression(query QueryConfig, windows []MaintenanceWindow, at time.Time) (*Suppression, error) {
+	var suppression *Suppression
+	add := func(reason, action string, until time.Time) {
+		if action == "" {
+			action = SuppressDefer
+		}
+		if suppression == nil {
+			suppression = &Suppression{Reason: reason, Action: action, Until: until}
+			return
+		}
+		if action == SuppressDrop && suppression.Action != SuppressDrop {
+			suppression.Reason, suppression.Action = reason, action
+		}
+		if until.After(suppression.Until) {
+			suppression.Until = until
+		}
+	}
+
+	for _, quiet := range query.QuietHours {
+		until, err := quiet.Until(at)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", query.Name, err)
+		}
+		if !until.IsZero() {
+			add("quiet hours", quiet.Action, until)
+		}
+	}
+	for _, window := range windows {
+		if window.covers(query.Name) && !at.Before(window.StartsAt) && at.Before(window.EndsAt) {
+			add(fmt.Sprintf("maintenance window %d", window.ID), window.Action, window.EndsAt)
+		}
+	}
+	return suppression, nil
+}
+
+// ActiveMaintenance returns maintenance windows active at the given time.
+func (t *StateTx) ActiveMaintenance(at time.Time) ([]MaintenanceWindow, error) {
+	return maintenanceWindows(t.tx, `WHERE starts_at <= ? AND ends_at > ?`, at.Unix(), at.Unix())
+}
+
+// ActiveMaintenance returns maintenance windows active at the given time.
+func (s *StateStore) ActiveMaintenance(at time.Time) ([]MaintenanceWindow, error) {
+	return maintenanceWindows(s.db, `WHERE starts_at <= ? AND ends_at > ?`, at.Unix(), at.Unix())
+}
+
+// StartMaintenance opens a window for the query, for all queries when query is empty, and returns its ID.
+func (s *StateStore) StartMaintenance(window MaintenanceWindow) (int64, error) {
+	res, err := s.db.Exec(`INSERT INTO maintenance (query, action, reason, starts_at, ends_at) VALUES (?, ?, ?, ?, ?)`,
+		window.Query, window.Action, window.Reason, window.StartsAt.Unix(), window.EndsAt.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// EndMaintenance closes active maintenance windows at the given time, all of them when no IDs
+// are given, so deferred notifications are sent right away. It returns how many were closed.
+func (s *StateStore) EndMaintenance(at time.Time, ids ...int64) (int64, error) {
+	return s.updateByIDs(`UPDATE maintenance SET ends_at = ? WHERE ends_at > ?`, ids, at.Unix(), at.Unix())
+}
+
+// PruneMaintenance forgets windows which ended before the given time.
+func (s *StateStore) PruneMaintenance(before time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM maintenance WHERE ends_at <= ?`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func maintenanceWindows(q querier, where string, args ...any) ([]MaintenanceWindow, error) {
+	rows, err := q.Query(`SELECT id, query, action, reason, starts_at, ends_at FROM maintenance `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var windows []MaintenanceWindow
+	for rows.Next() {
+		var window MaintenanceWindow
+		var startsAt, endsAt int64
+		err := rows.Scan(&window.ID, &window.Query, &window.Action, &window.Reason, &startsAt, &endsAt)
+		if err != nil {
+			return nil, err
+		}
+		window.StartsAt = time.Unix(startsAt, 0)
+		window.EndsAt = time.Unix(endsAt, 0)
+		windows = append(windows, window)
+	}
+	return windows, rows.Err()
+}
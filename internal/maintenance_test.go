@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestQuietHoursUntil(t *testing.T) {
+	utc := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2026, month, day, hour, min, 0, 0, time.UTC)
+	}
+	night := QuietHoursConfig{From: "22:00", To: "06:00", Timezone: "UTC"}
+	office := QuietHoursConfig{From: "09:00", To: "17:00", Timezone: "UTC"}
+	// 2026-10-17 is a Saturday
+	weekend := QuietHoursConfig{From: "22:00", To: "07:00", Days: []string{"Sat", "sun"}, Timezone: "UTC"}
+	// Berlin switches to summer time on 2026-03-29 and back on 2026-10-25
+	berlin := QuietHoursConfig{From: "22:00", To: "07:00", Timezone: "Europe/Berlin"}
+
+	tests := []struct {
+		name  string
+		quiet QuietHoursConfig
+		at    time.Time
+		want  time.Time
+	}{
+		{"before night", night, utc(10, 17, 21, 59), time.Time{}},
+		{"night start", night, utc(10, 17, 22, 0), utc(10, 18, 6, 0)},
+		{"before midnight", night, utc(10, 17, 23, 30), utc(10, 18, 6, 0)},
+		{"after midnight", night, utc(10, 18, 5, 59), utc(10, 18, 6, 0)},
+		{"night end", night, utc(10, 18, 6, 0), time.Time{}},
+		{"within day", office, utc(10, 17, 12, 0), utc(10, 17, 17, 0)},
+		{"after day", office, utc(10, 17, 17, 0), time.Time{}},
+		{"friday night", weekend, utc(10, 16, 23, 0), time.Time{}},
+		{"saturday night", weekend, utc(10, 17, 23, 0), utc(10, 18, 7, 0)},
+		{"sunday night over midnight", weekend, utc(10, 19, 3, 0), utc(10, 19, 7, 0)},
+		{"monday night", weekend, utc(10, 19, 23, 0), time.Time{}},
+		{"berlin winter", berlin, utc(1, 10, 21, 30), utc(1, 11, 6, 0)},
+		{"berlin summer", berlin, utc(7, 10, 20, 30), utc(7, 11, 5, 0)},
+		{"berlin before summer time", berlin, utc(3, 28, 22, 0), utc(3, 29, 5, 0)},
+		{"berlin after summer time", berlin, utc(3, 29, 1, 30), utc(3, 29, 5, 0)},
+		{"berlin summer time night start", berlin, utc(3, 29, 20, 0), utc(3, 30, 5, 0)},
+		{"berlin before winter time", berlin, utc(10, 24, 21, 0), utc(10, 25, 6, 0)},
+		{"berlin after winter time", berlin, utc(10, 25, 5, 59), utc(10, 25, 6, 0)},
+		{"berlin winter time end", berlin, utc(10, 25, 6, 0), time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.quiet.Until(tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("Until(%s) = %s, want %s", tt.at, got, tt.want)
+			}
+			if !got.IsZero() && got.Location() != tt.at.Location() {
+				t.Errorf("Until(%s) is in %s", tt.at, got.Location())
+			}
+		})
+	}
+}
+
+func TestQuietHoursUntilInvalid(t *testing.T) {
+	tests := []struct {
+		quiet   QuietHoursConfig
+		wantErr string
+	}{
+		{QuietHoursConfig{From: "22:00", To: "06:00", Timezone: "Mars/Olympus"}, "invalid quiet hours timezone"},
+		{QuietHoursConfig{From: "10pm", To: "06:00"}, "invalid quiet hours start"},
+		{QuietHoursConfig{From: "22:00", To: "24:30"}, "invalid quiet hours end"},
+		{QuietHoursConfig{From: "22:00", To: "06:00", Days: []string{"someday"}}, "invalid quiet hours day"},
+		{QuietHoursConfig{From: "22:00", To: "06:00", Action: "mute"}, "unknown quiet hours action"},
+	}
+	for _, tt := range tests {
+		_, err := tt.quiet.Until(time.Now())
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Until() of %+v error = %v, want %q", tt.quiet, err, tt.wantErr)
+		}
+	}
+}
+
+func TestQuerySuppression(t *testing.T) {
+	config := &Config{}
+	at := time.Date(2026, 10, 17, 23, 0, 0, 0, time.UTC)
+	query := QueryConfig{
+		Name:       "orders",
+		QuietHours: []QuietHoursConfig{{From: "22:00", To: "06:00", Timezone: "UTC"}},
+	}
+	quietEnd := time.Date(2026, 10, 18, 6, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		query   QueryConfig
+		windows []MaintenanceWindow
+		want    *Suppression
+	}{
+		{"none", QueryConfig{Name: "orders"}, nil, nil},
+		{"quiet hours defer by default", query, nil, &Suppression{Reason: "quiet hours", Action: SuppressDefer, Until: quietEnd}},
+		{"window of another query", QueryConfig{Name: "orders"}, []MaintenanceWindow{
+			{ID: 1, Query: "payments", Action: SuppressDrop, StartsAt: at.Add(-time.Hour), EndsAt: at.Add(time.Hour)},
+		}, nil},
+		{"window not started", QueryConfig{Name: "orders"}, []MaintenanceWindow{
+			{ID: 1, Action: SuppressDrop, StartsAt: at.Add(time.Minute), EndsAt: at.Add(time.Hour)},
+		}, nil},
+		{"drop wins, latest end", query, []MaintenanceWindow{
+			{ID: 1, Query: "orders", Action: SuppressDrop, Reason: "deploy", StartsAt: at.Add(-time.Hour), EndsAt: at.Add(time.Hour)},
+			{ID: 2, Action: SuppressDefer, StartsAt: at.Add(-time.Hour), EndsAt: at.Add(12 * time.Hour)},
+		}, &Suppression{Reason: "maintenance window 1", Action: SuppressDrop, Until: at.Add(12 * time.Hour)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := config.QuerySuppression(tt.query, tt.windows, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != (tt.want == nil) ||
+				(got != nil && (got.Reason != tt.want.Reason || got.Action != tt.want.Action || !got.Until.Equal(tt.want.Until))) {
+				t.Errorf("suppression = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	query.QuietHours[0].Timezone = "Nowhere/Town"
+	if _, err := config.QuerySuppression(query, nil, at); err == nil || !strings.Contains(err.Error(), "query orders") {
+		t.Errorf("error = %v, want the query named", err)
+	}
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	store := openTestStore(t)
+	t0 := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	activeIDs := func(at time.Time) []int64 {
+		t.Helper()
+		windows, err := store.ActiveMaintenance(at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, window := range windows {
+			ids = append(ids, window.ID)
+		}
+		return ids
+	}
+	start := func(window MaintenanceWindow) int64 {
+		t.Helper()
+		id, err := store.StartMaintenance(window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	all := start(MaintenanceWindow{Action: SuppressDefer, Reason: "upgrade", StartsAt: t0, EndsAt: t0.Add(time.Hour)})
+	orders := start(MaintenanceWindow{Query: "orders", Action: SuppressDrop, StartsAt: t0, EndsAt: t0.Add(2 * time.Hour)})
+	payments := start(MaintenanceWindow{Query: "payments", Action: SuppressDefer, StartsAt: t0, EndsAt: t0.Add(3 * time.Hour)})
+
+	if ids := activeIDs(t0.Add(-time.Second)); len(ids) != 0 {
+		t.Errorf("windows active before their start: %v", ids)
+	}
+	windows, err := store.ActiveMaintenance(t0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 3 || windows[0].ID != all || windows[0].Reason != "upgrade" || windows[0].Query != "" ||
+		!windows[0].EndsAt.Equal(t0.Add(time.Hour)) || windows[1].Action != SuppressDrop {
+		t.Fatalf("active windows = %+v", windows)
+	}
+	if ids := activeIDs(t0.Add(time.Hour)); len(ids) != 2 || ids[0] != orders {
+		t.Errorf("active windows after the first ended = %v", ids)
+	}
+
+	// Ending by ID leaves the others open
+	now := t0.Add(90 * time.Minute)
+	if ended, err := store.EndMaintenance(now, orders, all); err != nil || ended != 1 {
+		t.Fatalf("EndMaintenance(orders, all) = %d, %v, want only the active one ended", ended, err)
+	}
+	if ids := activeIDs(now); len(ids) != 1 || ids[0] != payments {
+		t.Errorf("active windows = %v, want payments", ids)
+	}
+	if ended, err := store.EndMaintenance(now); err != nil || ended != 1 {
+		t.Fatalf("EndMaintenance() = %d, %v", ended, err)
+	}
+	if ids := activeIDs(now); len(ids) != 0 {
+		t.Errorf("active windows after ending all: %v", ids)
+	}
+
+	if pruned, err := store.PruneMaintenance(t0.Add(time.Hour)); err != nil || pruned != 1 {
+		t.Errorf("PruneMaintenance() = %d, %v, want the first window", pruned, err)
+	}
+	if pruned, err := store.PruneMaintenance(now); err != nil || pruned != 2 {
+		t.Errorf("PruneMaintenance() = %d, %v, want the ended windows", pruned, err)
+	}
+}
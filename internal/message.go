@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// MessageData is available inside notification message templates, e.g.
+// "{{.Count}} new orders{{range .Rows}}\n{{.email}}: {{.total}}{{end}}".
+// Value is set for threshold queries only, Status and Duration for
+// firing/resolved notifications of condition based queries, Added, Removed
+// and Changed for diff queries.
+type MessageData struct {
+	Name     string
+	Count    int
+	Columns  []string
+	Rows     []map[string]string
+	Value    string
+	Status   string
+	Duration time.Duration
+	Added    []map[string]string
+	Removed  []map[string]string
+	Changed  []map[string]string
+	Time     time.Time
+}
+
+func NewMessageData(name string, columns []string, rows []Row) MessageData {
+	return MessageData{
+		Name:    name,
+		Count:   len(rows),
+		Columns: columns,
+		Rows:    rowValues(rows),
+		Time:    time.Now(),
+	}
+}
+
+func rowValues(rows []Row) []map[string]string {
+	values := make([]map[string]string, len(rows))
+	for i, row := range rows {
+		values[i] = row.Values
+	}
+	return values
+}
+
+func NewDiffMessageData(name string, columns []string, rows []Row, diff ResultDiff) MessageData {
+	data := NewMessageData(name, columns, rows)
+	data.Added = rowValues(diff.Added)
+	data.Removed = rowValues(diff.Removed)
+	data.Changed = rowValues(diff.Changed)
+	return data
+}
+
+// RenderMessage executes message as a text/template. Messages without template
+// actions keep the old behaviour: "<name>: " prefix and one %d for rows number.
+func RenderMessage(message string, data MessageData) (string, error) {
+	if !strings.Contains(message, "{{") {
+		return fmt.Sprintf(data.Name+": "+message, data.Count), nil
+	}
+
+	tmpl, err := template.New(data.Name).Option("missingkey=zero").Parse(message)
+	if err != nil {
+		return "", fmt.Errorf("message template for query %s: %w", data.Name, err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("message template for query %s: %w", data.Name, err)
+	}
+	return b.String(), nil
+}
+
+// QueryMessage picks the query's own message or falls back to the global one.
+func (c *Config) QueryMessage(query QueryConfig) string {
+	if query.Message != "" {
+		return query.Message
+	}
+	return c.NotificationMessage
+}
+
+// QuerySeverity returns severity of the query alerts, critical by default.
+func (c *Config) QuerySeverity(query QueryConfig) string {
+	if query.Severity != "" {
+		return query.Severity
+	}
+	return SeverityCritical
+}
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	NotifierNtfy         = "ntfy"
+	NotifierSlack        = "slack"
+	NotifierTelegram     = "telegram"
+	NotifierEmail        = "email"
+	NotifierDiscord      = "discord"
+	NotifierTeams        = "teams"
+	NotifierPagerDuty    = "pagerduty"
+	NotifierAlertmanager = "alertmanager"
+	NotifierOpsgenie     = "opsgenie"
+	NotifierWebhook      = "webhook"
+)
+
+// NotifierNames lists notifiers a query may select, the first one is the default.
+var NotifierNames = []string{NotifierNtfy, NotifierSlack, NotifierTelegram, NotifierEmail, NotifierDiscord, NotifierTeams, NotifierPagerDuty, NotifierAlertmanager, NotifierOpsgenie, NotifierWebhook}
+
+var urlNotifiers = []string{NotifierSlack, NotifierDiscord, NotifierTeams, NotifierAlertmanager, NotifierWebhook}
+
+// maxTableRows limits how many rows notifiers render, the rest is summarized.
+const maxTableRows = 10
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Notification is everything a notifier may need to deliver an alert.
+// Status is empty for new rows and diff notifications. ID is the idempotency
+// key of the delivery, it is the same for every retry. Repeat marks a firing
+// notification sent again to keep the alert active, rate limits don't count it.
+// SentParts counts parts of a split message delivered by earlier attempts.
+type Notification struct {
+	ID        string
+	Query     string
+	Message   string
+	Status    string
+	Columns   []string
+	Rows      []map[string]string
+	Time      time.Time
+	Repeat    bool
+	SentParts int
+}
+
+// Notification wraps the rendered message together with the data it was rendered from.
+func (d MessageData) Notification(message string) Notification {
+	return Notification{
+		Query:   d.Name,
+		Message: message,
+		Status:  d.Status,
+		Columns: d.Columns,
+		Rows:    d.Rows,
+		Time:    d.Time,
+	}
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NewNotifier builds the notifier selected by the query, ntfy by default.
+func NewNotifier(config *Config, query QueryConfig) (Notifier, error) {
+	url := query.NotificationURL
+
+	// Webhooks are per channel and Alertmanager is not ntfy, BaseNotificationURL doesn't fit them
+	if url == "" && slices.Contains(urlNotifiers, query.Notifier) {
+		return nil, fmt.Errorf("%s notifier of query %s needs notificationUrl", query.Notifier, query.Name)
+	}
+
+	switch query.Notifier {
+	case "", NotifierNtfy:
+		if url == "" {
+			url = config.BaseNotificationURL
+		}
+		return newNtfyNotifier(config, query, url)
+	case NotifierSlack:
+		return slackNotifier{url: url}, nil
+	case NotifierDiscord:
+		return discordNotifier{url: url}, nil
+	case NotifierTeams:
+		return teamsNotifier{url: url}, nil
+	case NotifierTelegram:
+		return newTelegramNotifier(config, query)
+	case NotifierEmail:
+		return newEmailNotifier(config, query)
+	case NotifierPagerDuty:
+		return newPagerDutyNotifier(config, query)
+	case NotifierAlertmanager:
+		return newAlertmanagerNotifier(config, query)
+	case NotifierOpsgenie:
+		return newOpsgenieNotifier(config, query)
+	case NotifierWebhook:
+		return newWebhookNotifier(query)
+	}
+	return nil, fmt.Errorf("unknown notifier %q of query %s", query.Notifier, query.Name)
+}
+
+// templateData is available inside templates of notifier settings (webhook request, ntfy title, etc.),
+// e.g. {"text": {{json .Message}}, "ids": [{{range $i, $row := .Rows}}{{if $i}}, {{end}}{{json $row.id}}{{end}}]}.
+// Row is the first row, handy for alerts about a single row.
+type templateData struct {
+	ID      string
+	Name    string
+	Message string
+	Status  string
+	Count   int
+	Columns []string
+	Rows    []map[string]string
+	Row     map[string]string
+	Time    time.Time
+}
+
+func newTemplateData(n Notification) templateData {
+	data := templateData{
+		ID:      n.ID,
+		Name:    n.Query,
+		Message: n.Message,
+		Status:  n.Status,
+		Count:   len(n.Rows),
+		Columns: n.Columns,
+		Rows:    n.Rows,
+		Time:    n.Time,
+	}
+	if len(n.Rows) > 0 {
+		data.Row = n.Rows[0]
+	}
+	return data
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// parseTemplate parses a notifier setting of the query, name is used in errors.
+func parseTemplate(query, name, text string) (*template.Template, error) {
+	tmpl, err := template.New(query).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("%s template for query %s: %w", name, query, err)
+	}
+	return tmpl, nil
+}
+
+func renderTemplate(tmpl *template.Template, data templateData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("template for query %s: %w", data.Name, err)
+	}
+	return b.String(), nil
+}
+
+// ConfigError is a delivery failure which retries can't fix, e.g. a webhook body which is
+// not JSON. Notifications failing with it go to dead letters right away.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// PartialError is a failure after Parts parts of a message split into several ones were
+// delivered, they are remembered so the retry continues with the next part.
+type PartialError struct {
+	Parts int
+	Err   error
+}
+
+func (e *PartialError) Error() string {
+	return fmt.Sprintf("%v (after %d delivered parts)", e.Err, e.Parts)
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// doRequest sends the request and fails unless the response has one of the expected statuses,
+// any 2xx one when none are given.
+func doRequest(req *http.Request, expected ...int) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if len(expected) == 0 && resp.StatusCode/100 == 2 {
+		return nil
+	}
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	return fmt.Errorf("HTTP request failed with status code: %d", resp.StatusCode)
+}
+
+// textTable renders rows as an aligned plain text table for monospace output.
+func textTable(columns []string, rows []map[string]string) string {
+	return textTableLimit(columns, rows, maxTableRows)
+}
+
+func textTableLimit(columns []string, rows []map[string]string, limit int) string {
+	shown := rows
+	if len(shown) > limit {
+		shown = shown[:limit]
+	}
+
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = utf8.RuneCountInString(column)
+		for _, row := range shown {
+			widths[i] = max(widths[i], utf8.RuneCountInString(row[column]))
+		}
+	}
+
+	var b strings.Builder
+	writeLine := func(cell func(column string) string) {
+		for i, column := range columns {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			value := cell(column)
+			b.WriteString(value + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value)))
+		}
+		b.WriteString("\n")
+	}
+
+	writeLine(func(column string) string { return column })
+	for _, row := range shown {
+		writeLine(func(column string) string { return row[column] })
+	}
+	if more := len(rows) - len(shown); more > 0 {
+		fmt.Fprintf(&b, "... and %d more\n", more)
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// truncate cuts s to at most limit runes marking the cut with an ellipsis.
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
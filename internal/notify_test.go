@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+// recordServer is a local stand-in for notification services, it answers every request with status.
+func recordServer(t *testing.T, status int) (*httptest.Server, func() []recordedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, recordedRequest{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: string(body)})
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []recordedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]recordedRequest(nil), requests...)
+	}
+}
+
+func testNotification() Notification {
+	return Notification{
+		ID:      "0123456789abcdef",
+		Query:   "orders",
+		Message: "orders: 2 new <rows>",
+		Columns: []string{"id", "email"},
+		Rows: []map[string]string{
+			{"id": "1", "email": "a@example.com"},
+			{"id": "2", "email": "b@example.com"},
+		},
+		Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func notify(t *testing.T, config *Config, query QueryConfig, n Notification) error {
+	t.Helper()
+	notifier, err := NewNotifier(config, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return notifier.Notify(context.Background(), n)
+}
+
+func TestNewNotifierNeedsURL(t *testing.T) {
+	for _, notifier := range urlNotifiers {
+		query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: notifier}}
+		if _, err := NewNotifier(&Config{BaseNotificationURL: "https://ntfy.sh/sqlal"}, query); err == nil {
+			t.Errorf("%s notifier without notificationUrl was built", notifier)
+		}
+	}
+	if _, err := NewNotifier(&Config{}, QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: "pigeon"}}); err == nil {
+		t.Error("unknown notifier was built")
+	}
+}
+
+func TestDoRequestStatus(t *testing.T) {
+	server, _ := recordServer(t, http.StatusInternalServerError)
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{NotificationURL: server.URL + "/topic"}}
+	if err := notify(t, &Config{}, query, testNotification()); err == nil {
+		t.Error("Notify() succeeded on status 500, want error")
+	}
+}
+
+func TestTextTable(t *testing.T) {
+	got := textTable([]string{"id", "email"}, []map[string]string{{"id": "1", "email": "a@x"}, {"id": "22", "email": "b"}})
+	want := "id | email\n1  | a@x  \n22 | b    "
+	if got != want {
+		t.Errorf("textTable() =\n%s\nwant\n%s", got, want)
+	}
+}
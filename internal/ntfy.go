@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// ntfy priorities by name, numbers 1-5 are accepted as well
+var ntfyPriorities = map[string]int{"min": 1, "low": 2, "default": 3, "high": 4, "urgent": 5, "max": 5}
+
+type ntfyNotifier struct {
+	url      string
+	settings NtfyConfig
+	query    string
+}
+
+// ntfyMessage is the JSON publish format, see https://docs.ntfy.sh/publish/#publish-as-json
+type ntfyMessage struct {
+	Topic    string       `json:"topic"`
+	Message  string       `json:"message"`
+	Title    string       `json:"title,omitempty"`
+	Priority int          `json:"priority,omitempty"`
+	Tags     []string     `json:"tags,omitempty"`
+	Click    string       `json:"click,omitempty"`
+	Actions  []NtfyAction `json:"actions,omitempty"`
+}
+
+// newNtfyNotifier uses ntfy settings of the query, or the ones of config for queries without them,
+// so auth of a protected server is set once for baseNotificationUrl and every query.
+func newNtfyNotifier(config *Config, query QueryConfig, url string) (Notifier, error) {
+	n := ntfyNotifier{url: url, query: query.Name}
+	if query.Ntfy != nil {
+		n.settings = *query.Ntfy
+	} else if config.Ntfy != nil {
+		n.settings = *config.Ntfy
+	}
+	return n, nil
+}
+
+// Notify publishes the message to the topic URL with settings as ntfy headers,
+// or to the server root in JSON format when the query asks for it.
+func (n ntfyNotifier) Notify(ctx context.Context, notification Notification) error {
+	message, err := n.message(notification)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+	if n.settings.JSON {
+		req, err = n.jsonRequest(ctx, message)
+	} else {
+		req, err = n.headerRequest(ctx, message)
+	}
+	if err != nil {
+		return err
+	}
+
+	if n.settings.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.settings.Token)
+	} else if n.settings.Username != "" {
+		req.SetBasicAuth(n.settings.Username, n.settings.Password)
+	}
+
+	return doRequest(req, http.StatusOK)
+}
+
+func (n ntfyNotifier) headerRequest(ctx context.Context, message ntfyMessage) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(message.Message))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	// ntfy decodes RFC 2047 words, ASCII values are left as is
+	setHeader := func(name, value string) {
+		if value != "" {
+			req.Header.Set(name, mime.QEncoding.Encode("utf-8", value))
+		}
+	}
+	setHeader("Title", message.Title)
+	if message.Priority != 0 {
+		setHeader("Priority", strconv.Itoa(message.Priority))
+	}
+	setHeader("Tags", strings.Join(message.Tags, ","))
+	setHeader("Click", message.Click)
+	if len(message.Actions) > 0 {
+		// Besides the short format the Actions header accepts a JSON array
+		actions, err := json.Marshal(message.Actions)
+		if err != nil {
+			return nil, err
+		}
+		setHeader("Actions", string(actions))
+	}
+	return req, nil
+}
+
+func (n ntfyNotifier) jsonRequest(ctx context.Context, message ntfyMessage) (*http.Request, error) {
+	// The topic is the last path element of the URL, JSON messages are posted to the server root
+	topicURL, err := url.Parse(n.url)
+	if err != nil {
+		return nil, err
+	}
+	message.Topic = path.Base(topicURL.Path)
+	topicURL.Path = path.Dir(topicURL.Path)
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, topicURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// message renders templates of the query ntfy settings.
+func (n ntfyNotifier) message(notification Notification) (ntfyMessage, error) {
+	data := newTemplateData(notification)
+	var err error
+	render := func(name, text string) string {
+		if text == "" || err != nil {
+			return ""
+		}
+		var tmpl *template.Template
+		tmpl, err = parseTemplate(n.query, "ntfy "+name, text)
+		if err != nil {
+			return ""
+		}
+		var value string
+		value, err = renderTemplate(tmpl, data)
+		return strings.TrimSpace(value)
+	}
+
+	message := ntfyMessage{
+		Message: notification.Message,
+		Title:   render("title", n.settings.Title),
+		Click:   render("click", n.settings.Click),
+	}
+	for _, tag := range n.settings.Tags {
+		if tag = render("tag", tag); tag != "" {
+			message.Tags = append(message.Tags, tag)
+		}
+	}
+	for _, action := range n.settings.Actions {
+		action.Label = render("action label", action.Label)
+		action.URL = render("action url", action.URL)
+		action.Body = render("action body", action.Body)
+		message.Actions = append(message.Actions, action)
+	}
+
+	priority := render("priority", n.settings.Priority)
+	if err != nil {
+		return ntfyMessage{}, err
+	}
+	if priority != "" {
+		if message.Priority, err = parseNtfyPriority(priority); err != nil {
+			return ntfyMessage{}, fmt.Errorf("ntfy priority of query %s: %w", n.query, err)
+		}
+	}
+	return message, nil
+}
+
+func parseNtfyPriority(priority string) (int, error) {
+	if value, ok := ntfyPriorities[strings.ToLower(priority)]; ok {
+		return value, nil
+	}
+	value, err := strconv.Atoi(priority)
+	if err != nil || value < 1 || value > 5 {
+		return 0, fmt.Errorf("unknown priority %q, use 1-5, min, low, default, high or urgent", priority)
+	}
+	return value, nil
+}
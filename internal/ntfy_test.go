@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"testing"
+)
+
+func TestNtfyNotifyHeaders(t *testing.T) {
+	server, requests := recordServer(t, http.StatusOK)
+	query := QueryConfig{
+		Name: "orders",
+		TargetConfig: TargetConfig{
+			NotificationURL: server.URL + "/orders",
+			Ntfy: &NtfyConfig{
+				Title:    "{{.Count}} new orders – {{.Row.email}}",
+				Priority: "{{if gt .Count 1}}urgent{{else}}low{{end}}",
+				Tags:     []string{"moneybag", "{{.Name}}"},
+				Click:    "https://shop.example.com/orders/{{.Row.id}}",
+				Actions:  []NtfyAction{{Action: "view", Label: "Open {{.Row.id}}", URL: "https://shop.example.com/{{.Row.id}}"}},
+				Token:    "tk_secret",
+			},
+		},
+	}
+	n := testNotification()
+	if err := notify(t, &Config{}, query, n); err != nil {
+		t.Fatal(err)
+	}
+
+	got := requests()
+	if len(got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(got))
+	}
+	r := got[0]
+	if r.Path != "/orders" || r.Body != n.Message {
+		t.Errorf("request to %s with body %q", r.Path, r.Body)
+	}
+
+	title, err := new(mime.WordDecoder).DecodeHeader(r.Header.Get("Title"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"Priority":      "5",
+		"Tags":          "moneybag,orders",
+		"Click":         "https://shop.example.com/orders/1",
+		"Authorization": "Bearer tk_secret",
+		"Actions":       `[{"action":"view","label":"Open 1","url":"https://shop.example.com/1"}]`,
+	}
+	if title != "2 new orders – a@example.com" {
+		t.Errorf("Title = %q", title)
+	}
+	for name, value := range want {
+		if got := r.Header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestNtfyNotifyJSON(t *testing.T) {
+	server, requests := recordServer(t, http.StatusOK)
+	query := QueryConfig{
+		Name: "orders",
+		TargetConfig: TargetConfig{
+			NotificationURL: server.URL + "/orders",
+			Ntfy:            &NtfyConfig{Title: "New orders", Priority: "4", JSON: true, Username: "bot", Password: "pass"},
+		},
+	}
+	if err := notify(t, &Config{}, query, testNotification()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := requests()[0]
+	if r.Path != "/" {
+		t.Errorf("JSON message posted to %s, want server root", r.Path)
+	}
+	if auth := r.Header.Get("Authorization"); auth != "Basic "+base64.StdEncoding.EncodeToString([]byte("bot:pass")) {
+		t.Errorf("Authorization = %q", auth)
+	}
+
+	var message ntfyMessage
+	if err := json.Unmarshal([]byte(r.Body), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Topic != "orders" || message.Title != "New orders" || message.Priority != 4 || message.Message != "orders: 2 new <rows>" {
+		t.Errorf("message = %+v", message)
+	}
+}
+
+func TestNtfyConfigDefaults(t *testing.T) {
+	server, requests := recordServer(t, http.StatusOK)
+	config := &Config{BaseNotificationURL: server.URL + "/sqlal", Ntfy: &NtfyConfig{Token: "tk_base"}}
+
+	if err := notify(t, config, QueryConfig{Name: "sqlal"}, Notification{Query: "sqlal", Message: "Monitoring server started"}); err != nil {
+		t.Fatal(err)
+	}
+	own := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Ntfy: &NtfyConfig{Token: "tk_own"}}}
+	if err := notify(t, config, own, testNotification()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := requests()
+	if got[0].Path != "/sqlal" || got[0].Header.Get("Authorization") != "Bearer tk_base" {
+		t.Errorf("startup message to %s with %q", got[0].Path, got[0].Header.Get("Authorization"))
+	}
+	if got[1].Header.Get("Authorization") != "Bearer tk_own" {
+		t.Errorf("own ntfy settings are not preferred: %q", got[1].Header.Get("Authorization"))
+	}
+}
+
+func TestParseNtfyPriority(t *testing.T) {
+	for priority, want := range map[string]int{"min": 1, "LOW": 2, "default": 3, "high": 4, "urgent": 5, "max": 5, "1": 1, "5": 5} {
+		got, err := parseNtfyPriority(priority)
+		if err != nil || got != want {
+			t.Errorf("parseNtfyPriority(%q) = %d, %v, want %d", priority, got, err, want)
+		}
+	}
+	for _, priority := range []string{"0", "6", "loud"} {
+		if _, err := parseNtfyPriority(priority); err == nil {
+			t.Errorf("parseNtfyPriority(%q) succeeded, want error", priority)
+		}
+	}
+}
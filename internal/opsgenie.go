@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultOpsgenieAPIURL = "https://api.opsgenie.com"
+	opsgenieMessageLimit  = 130
+)
+
+var opsgeniePriorities = map[string]string{
+	SeverityCritical: "P1",
+	SeverityError:    "P2",
+	SeverityWarning:  "P3",
+	SeverityInfo:     "P5",
+}
+
+type opsgenieNotifier struct {
+	apiURL   string
+	apiKey   string
+	database string
+	severity string
+}
+
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Tags        []string          `json:"tags"`
+	Details     map[string]string `json:"details"`
+	Priority    string            `json:"priority"`
+	Source      string            `json:"source"`
+}
+
+func newOpsgenieNotifier(config *Config, query QueryConfig) (Notifier, error) {
+	if config.Opsgenie == nil || config.Opsgenie.APIKey == "" {
+		return nil, fmt.Errorf("opsgenie notifier of query %s needs opsgenie apiKey", query.Name)
+	}
+
+	apiURL := config.Opsgenie.APIURL
+	if apiURL == "" {
+		apiURL = defaultOpsgenieAPIURL
+	}
+
+	database, err := config.QueryDatabase(query)
+	if err != nil {
+		return nil, err
+	}
+	return opsgenieNotifier{
+		apiURL:   strings.TrimRight(apiURL, "/"),
+		apiKey:   config.Opsgenie.APIKey,
+		database: database,
+		severity: config.QuerySeverity(query),
+	}, nil
+}
+
+// Notify creates an alert with the query name as alias, so repeated alerts are deduplicated,
+// and closes it when the query is resolved.
+func (o opsgenieNotifier) Notify(ctx context.Context, n Notification) error {
+	alias := "sqlal/" + n.Query
+
+	if n.Status == AlertResolved {
+		endpoint := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", o.apiURL, url.PathEscape(alias))
+		return o.post(ctx, endpoint, map[string]string{"source": "sqlal", "note": n.Message})
+	}
+
+	priority, ok := opsgeniePriorities[o.severity]
+	if !ok {
+		priority = "P3"
+	}
+
+	alert := opsgenieAlert{
+		Message:     truncate(n.Message, opsgenieMessageLimit),
+		Alias:       alias,
+		Description: n.Message,
+		Tags:        []string{"sqlal", n.Query, o.database, o.severity},
+		Details: map[string]string{
+			"query":    n.Query,
+			"database": o.database,
+			"severity": o.severity,
+			"rows":     fmt.Sprint(len(n.Rows)),
+		},
+		Priority: priority,
+		Source:   "sqlal",
+	}
+	if len(n.Rows) > 0 && len(n.Columns) > 0 {
+		alert.Description += "\n\n" + textTable(n.Columns, n.Rows)
+	}
+	return o.post(ctx, o.apiURL+"/v2/alerts", alert)
+}
+
+func (o opsgenieNotifier) post(ctx context.Context, endpoint string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+o.apiKey)
+
+	// Opsgenie processes requests asynchronously
+	return doRequest(req, http.StatusAccepted)
+}
@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOpsgenieNotify(t *testing.T) {
+	server, requests := recordServer(t, http.StatusAccepted)
+	config := &Config{
+		Databases: map[string]DatabaseConfig{"shop": {}},
+		Opsgenie:  &OpsgenieConfig{APIKey: "secret", APIURL: server.URL + "/"},
+	}
+	query := QueryConfig{Name: "orders", Severity: SeverityError, TargetConfig: TargetConfig{Notifier: NotifierOpsgenie}}
+
+	n := testNotification()
+	n.Status = AlertFiring
+	n.Message = strings.Repeat("x", 200)
+	if err := notify(t, config, query, n); err != nil {
+		t.Fatal(err)
+	}
+	got := requests()[0]
+	if got.Path != "/v2/alerts" || got.Header.Get("Authorization") != "GenieKey secret" {
+		t.Errorf("request %s with Authorization %q", got.Path, got.Header.Get("Authorization"))
+	}
+	var alert opsgenieAlert
+	if err := json.Unmarshal([]byte(got.Body), &alert); err != nil {
+		t.Fatal(err)
+	}
+	if alert.Alias != "sqlal/orders" || alert.Priority != "P2" || alert.Source != "sqlal" {
+		t.Errorf("alert = %+v", alert)
+	}
+	if len([]rune(alert.Message)) > opsgenieMessageLimit {
+		t.Errorf("message has %d characters, limit is %d", len([]rune(alert.Message)), opsgenieMessageLimit)
+	}
+	if !strings.HasPrefix(alert.Description, n.Message+"\n\n") || !strings.Contains(alert.Description, "b@example.com") {
+		t.Errorf("description = %q", alert.Description)
+	}
+	if !slices.Equal(alert.Tags, []string{"sqlal", "orders", "shop", SeverityError}) {
+		t.Errorf("tags = %v", alert.Tags)
+	}
+	if alert.Details["database"] != "shop" || alert.Details["rows"] != "2" {
+		t.Errorf("details = %v", alert.Details)
+	}
+
+	// Recovery closes the alert by its alias
+	n.Status = AlertResolved
+	n.Message = "orders: resolved"
+	if err := notify(t, config, query, n); err != nil {
+		t.Fatal(err)
+	}
+	got = requests()[1]
+	if got.Path != "/v2/alerts/sqlal/orders/close" {
+		t.Errorf("close path = %s", got.Path)
+	}
+	var note map[string]string
+	if err := json.Unmarshal([]byte(got.Body), &note); err != nil {
+		t.Fatal(err)
+	}
+	if note["note"] != "orders: resolved" || note["source"] != "sqlal" {
+		t.Errorf("close body = %v", note)
+	}
+}
+
+func TestOpsgeniePriority(t *testing.T) {
+	server, requests := recordServer(t, http.StatusAccepted)
+	config := &Config{
+		Databases: map[string]DatabaseConfig{"default": {}},
+		Opsgenie:  &OpsgenieConfig{APIKey: "secret", APIURL: server.URL},
+	}
+	tests := map[string]string{"": "P1", SeverityCritical: "P1", SeverityWarning: "P3", SeverityInfo: "P5", "unknown": "P3"}
+	for severity, want := range tests {
+		query := QueryConfig{Name: "orders", Severity: severity, TargetConfig: TargetConfig{Notifier: NotifierOpsgenie}}
+		if err := notify(t, config, query, testNotification()); err != nil {
+			t.Fatal(err)
+		}
+		got := requests()
+		var alert opsgenieAlert
+		if err := json.Unmarshal([]byte(got[len(got)-1].Body), &alert); err != nil {
+			t.Fatal(err)
+		}
+		if alert.Priority != want {
+			t.Errorf("severity %q: priority %s, want %s", severity, alert.Priority, want)
+		}
+	}
+}
+
+func TestOpsgenieNeedsAPIKey(t *testing.T) {
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierOpsgenie}}
+	if _, err := NewNotifier(&Config{Opsgenie: &OpsgenieConfig{}}, query); err == nil {
+		t.Error("opsgenie notifier without apiKey was built")
+	}
+}
@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Delivery policy: retries back off exponentially from OutboxBaseDelay up to OutboxMaxDelay,
+// after OutboxMaxAttempts failures the notification goes to dead letters. A target failing
+// CircuitThreshold times in a row is not tried for CircuitCooldown, then one attempt decides
+// whether it is back.
+const (
+	OutboxBaseDelay   = 10 * time.Second
+	OutboxMaxDelay    = time.Hour
+	OutboxMaxAttempts = 10
+	CircuitThreshold  = 5
+	CircuitCooldown   = 5 * time.Minute
+)
+
+// OutboxEntry is a notification waiting for delivery to one target.
+type OutboxEntry struct {
+	ID            int64
+	Key           string
+	Query         string
+	Target        string
+	Notification  Notification
+	Attempts      int
+	LastError     string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+}
+
+// NewOutboxEntry queues the notification for the target. The idempotency key identifies
+// this notification to this target, it stays the same across retries.
+func NewOutboxEntry(query, target string, n Notification) (OutboxEntry, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return OutboxEntry{}, err
+	}
+	sum := sha256.Sum256(append([]byte(query+"\x00"+target+"\x00"), data...))
+	n.ID = hex.EncodeToString(sum[:16])
+
+	now := time.Now()
+	return OutboxEntry{
+		Key:           n.ID,
+		Query:         query,
+		Target:        target,
+		Notification:  n,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}, nil
+}
+
+// RetryDelay is the backoff after the given number of failed attempts: 10s, 20s, 40s, ... 1h.
+func RetryDelay(attempts int) time.Duration {
+	delay := OutboxBaseDelay
+	for i := 1; i < attempts && delay < OutboxMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, OutboxMaxDelay)
+}
+
+// Enqueue stores notifications for delivery, an entry with a known key is stored once.
+func (t *StateTx) Enqueue(entries ...OutboxEntry) error {
+	stmt, err := t.tx.Prepare(`INSERT OR IGNORE INTO outbox
+		(idempotency_key, query, target, notification, created_at, next_attempt_at) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		data, err := json.Marshal(entry.Notification)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec(entry.Key, entry.Query, entry.Target, string(data),
+			entry.CreatedAt.Unix(), entry.NextAttemptAt.Unix())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DueOutbox returns notifications which should be sent at the given time. Only the oldest
+// notification of each query and target is returned, so they are delivered in order.
+func (s *StateStore) DueOutbox(at time.Time) ([]OutboxEntry, error) {
+	return s.outboxEntries(`WHERE dead = 0 AND next_attempt_at <= ? AND NOT EXISTS (
+		SELECT 1 FROM outbox earlier WHERE earlier.query = outbox.query AND earlier.target = outbox.target
+			AND earlier.dead = 0 AND earlier.id < outbox.id)`, at.Unix())
+}
+
+// DeadLetters returns notifications which failed every attempt.
+func (s *StateStore) DeadLetters() ([]OutboxEntry, error) {
+	return s.outboxEntries(`WHERE dead = 1`)
+}
+
+func (s *StateStore) outboxEntries(where string, args ...any) ([]OutboxEntry, error) {
+	rows, err := s.db.Query(`SELECT id, idempotency_key, query, target, notification, attempts, last_error,
+		created_at, next_attempt_at FROM outbox `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []OutboxEntry
+	for rows.Next() {
+		var entry OutboxEntry
+		var data string
+		var createdAt, nextAttemptAt int64
+		err := rows.Scan(&entry.ID, &entry.Key, &entry.Query, &entry.Target, &data, &entry.Attempts,
+			&entry.LastError, &createdAt, &nextAttemptAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &entry.Notification); err != nil {
+			return nil, err
+		}
+		entry.CreatedAt = time.Unix(createdAt, 0)
+		entry.NextAttemptAt = time.Unix(nextAttemptAt, 0)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Delivered removes the sent notification, closes the circuit of its target
+// and counts the notification for the target rate limit unless it is a repeat.
+func (s *StateStore) Delivered(entry OutboxEntry, at time.Time) error {
+	return s.Update(func(tx *StateTx) error {
+		if _, err := tx.tx.Exec(`DELETE FROM outbox WHERE id = ?`, entry.ID); err != nil {
+			return err
+		}
+		if _, err := tx.tx.Exec(`DELETE FROM circuits WHERE target = ?`, entry.Target); err != nil {
+			return err
+		}
+		if entry.Notification.Repeat {
+			return nil
+		}
+		return tx.RecordSend(SenderTarget, entry.Target, at)
+	})
+}
+
+// Pending reports whether notifications of the query to the target wait for delivery.
+func (t *StateTx) Pending(query, target string) (bool, error) {
+	var found int
+	err := t.tx.QueryRow(`SELECT 1 FROM outbox WHERE query = ? AND target = ? AND dead = 0 LIMIT 1`, query, target).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DeliveryFailed schedules the next attempt or moves the notification to dead letters
+// and counts the failure of its target. A ConfigError moves it to dead letters right away
+// without counting the target failure, a PartialError remembers the delivered parts.
+// It reports whether the notification is dead.
+func (s *StateStore) DeliveryFailed(entry OutboxEntry, deliveryErr error, at time.Time) (bool, error) {
+	var configErr *ConfigError
+	permanent := errors.As(deliveryErr, &configErr)
+	attempts := entry.Attempts + 1
+	dead := attempts >= OutboxMaxAttempts || permanent
+
+	n := entry.Notification
+	var partial *PartialError
+	if errors.As(deliveryErr, &partial) {
+		n.SentParts = partial.Parts
+	}
+	data, err := json.Marshal(n)
+	if err != nil {
+		return false, err
+	}
+
+	err = s.Update(func(tx *StateTx) error {
+		_, err := tx.tx.Exec(`UPDATE outbox SET attempts = ?, last_error = ?, next_attempt_at = ?, dead = ?, notification = ?
+			WHERE id = ?`, attempts, deliveryErr.Error(), at.Add(RetryDelay(attempts)).Unix(), dead, string(data), entry.ID)
+		if err != nil {
+			return err
+		}
+		// The target is fine, only this notification can't be sent
+		if permanent {
+			return nil
+		}
+
+		var failures int
+		err = tx.tx.QueryRow(`SELECT failures FROM circuits WHERE target = ?`, entry.Target).Scan(&failures)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		failures++
+
+		var openUntil int64
+		if failures >= CircuitThreshold {
+			openUntil = at.Add(CircuitCooldown).Unix()
+		}
+		_, err = tx.tx.Exec(`INSERT INTO circuits (target, failures, open_until) VALUES (?, ?, ?)
+			ON CONFLICT (target) DO UPDATE SET failures = excluded.failures, open_until = excluded.open_until`,
+			entry.Target, failures, openUntil)
+		return err
+	})
+	return dead, err
+}
+
+// CircuitOpen reports whether the target failed too many times to be tried at the given time.
+func (s *StateStore) CircuitOpen(target string, at time.Time) (bool, error) {
+	var openUntil int64
+	err := s.db.QueryRow(`SELECT open_until FROM circuits WHERE target = ?`, target).Scan(&openUntil)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return at.Unix() < openUntil, err
+}
+
+// RetryDeadLetters moves dead letters back to the outbox for a new round of attempts,
+// all of them when no IDs are given. It returns how many were moved.
+func (s *StateStore) RetryDeadLetters(ids ...int64) (int64, error) {
+	return s.updateByIDs(`UPDATE outbox SET dead = 0, attempts = 0, next_attempt_at = 0 WHERE dead = 1`, ids)
+}
+
+// PurgeDeadLetters forgets dead letters, all of them when no IDs are given.
+func (s *StateStore) PurgeDeadLetters(ids ...int64) (int64, error) {
+	return s.updateByIDs(`DELETE FROM outbox WHERE dead = 1`, ids)
+}
+
+// updateByIDs runs the statement for rows with given IDs, the statement must end with
+// a WHERE clause. Without IDs it runs once for every row matching the clause.
+func (s *StateStore) updateByIDs(stmt string, ids []int64, args ...any) (int64, error) {
+	if len(ids) == 0 {
+		res, err := s.db.Exec(stmt, args...)
+		if err != nil {
+			return 0, err
+		}
+		return res.RowsAffected()
+	}
+
+	var total int64
+	for _, id := range ids {
+		res, err := s.db.Exec(stmt+` AND id = ?`, append(args, id)...)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
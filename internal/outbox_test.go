@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *StateStore {
+	t.Helper()
+	store, err := OpenStateStore(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func enqueueTest(t *testing.T, store *StateStore, query, target, message string) OutboxEntry {
+	t.Helper()
+	entry, err := NewOutboxEntry(query, target, Notification{Query: query, Message: message})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Update(func(tx *StateTx) error {
+		return tx.Enqueue(entry)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func dueOutbox(t *testing.T, store *StateStore, at time.Time) []OutboxEntry {
+	t.Helper()
+	entries, err := store.DueOutbox(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{9, 2560 * time.Second},
+		{10, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := RetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("RetryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestEnqueueIdempotent(t *testing.T) {
+	store := openTestStore(t)
+	first := enqueueTest(t, store, "orders", "chat", "2 new rows")
+	enqueueTest(t, store, "orders", "chat", "2 new rows")
+
+	entries := dueOutbox(t, store, time.Now())
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if entries[0].Key != first.Key || entries[0].Notification.ID != first.Key {
+		t.Errorf("entry key %q, notification ID %q, want %q", entries[0].Key, entries[0].Notification.ID, first.Key)
+	}
+
+	other, _ := NewOutboxEntry("orders", "oncall", Notification{Query: "orders", Message: "2 new rows"})
+	if other.Key == first.Key {
+		t.Error("the same notification to another target has the same key")
+	}
+}
+
+func TestDueOutboxInOrder(t *testing.T) {
+	store := openTestStore(t)
+	enqueueTest(t, store, "orders", "chat", "first")
+	enqueueTest(t, store, "orders", "chat", "second")
+	enqueueTest(t, store, "orders", "oncall", "first")
+
+	now := time.Now()
+	entries := dueOutbox(t, store, now)
+	if len(entries) != 2 || entries[0].Target != "chat" || entries[0].Notification.Message != "first" ||
+		entries[1].Target != "oncall" || entries[1].Notification.Message != "first" {
+		t.Fatalf("due = %+v, want the first notification of each target", entries)
+	}
+	chat, oncall := entries[0], entries[1]
+
+	// A failing notification holds back the following ones of its query and target
+	if _, err := store.DeliveryFailed(chat, errors.New("timeout"), now); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delivered(oncall, now); err != nil {
+		t.Fatal(err)
+	}
+	if entries := dueOutbox(t, store, now); len(entries) != 0 {
+		t.Fatalf("due during backoff = %+v, want none", entries)
+	}
+
+	entries = dueOutbox(t, store, now.Add(OutboxBaseDelay))
+	if len(entries) != 1 || entries[0].ID != chat.ID || entries[0].Attempts != 1 {
+		t.Fatalf("due after backoff = %+v, want the failed notification", entries)
+	}
+	if err := store.Delivered(entries[0], now); err != nil {
+		t.Fatal(err)
+	}
+	if entries := dueOutbox(t, store, now); len(entries) != 1 || entries[0].Notification.Message != "second" {
+		t.Errorf("due after delivery = %+v, want the second notification", entries)
+	}
+}
+
+func TestDeliveryFailedDeadLetters(t *testing.T) {
+	store := openTestStore(t)
+	enqueueTest(t, store, "orders", "chat", "2 new rows")
+
+	at := time.Now()
+	for attempt := 1; attempt <= OutboxMaxAttempts; attempt++ {
+		entries := dueOutbox(t, store, at)
+		if len(entries) != 1 {
+			t.Fatalf("attempt %d: got %d due entries, want 1", attempt, len(entries))
+		}
+		if entries[0].Attempts != attempt-1 {
+			t.Errorf("attempt %d: entry has %d attempts", attempt, entries[0].Attempts)
+		}
+
+		dead, err := store.DeliveryFailed(entries[0], errors.New("HTTP 500"), at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dead != (attempt == OutboxMaxAttempts) {
+			t.Fatalf("attempt %d: dead = %v", attempt, dead)
+		}
+
+		// Not due before the backoff is over
+		if attempt < OutboxMaxAttempts && len(dueOutbox(t, store, at.Add(RetryDelay(attempt)-time.Second))) != 0 {
+			t.Fatalf("attempt %d: entry is due before its backoff", attempt)
+		}
+		at = at.Add(RetryDelay(attempt))
+	}
+
+	if entries := dueOutbox(t, store, at.Add(24*time.Hour)); len(entries) != 0 {
+		t.Fatalf("dead letter is still due: %+v", entries)
+	}
+	dead, err := store.DeadLetters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].Attempts != OutboxMaxAttempts || dead[0].LastError != "HTTP 500" {
+		t.Fatalf("dead letters = %+v", dead)
+	}
+
+	moved, err := store.RetryDeadLetters(dead[0].ID)
+	if err != nil || moved != 1 {
+		t.Fatalf("RetryDeadLetters() = %d, %v", moved, err)
+	}
+	if entries := dueOutbox(t, store, time.Now()); len(entries) != 1 || entries[0].Attempts != 0 {
+		t.Fatalf("retried dead letter is not due from scratch: %+v", entries)
+	}
+
+	entries := dueOutbox(t, store, time.Now())
+	entries[0].Attempts = OutboxMaxAttempts - 1
+	if dead, err := store.DeliveryFailed(entries[0], errors.New("HTTP 500"), time.Now()); err != nil || !dead {
+		t.Fatalf("DeliveryFailed() = %v, %v", dead, err)
+	}
+	removed, err := store.PurgeDeadLetters()
+	if err != nil || removed != 1 {
+		t.Fatalf("PurgeDeadLetters() = %d, %v", removed, err)
+	}
+	if dead, _ := store.DeadLetters(); len(dead) != 0 {
+		t.Errorf("dead letters after purge = %+v", dead)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	store := openTestStore(t)
+	entry := enqueueTest(t, store, "orders", "chat", "2 new rows")
+	entry = dueOutbox(t, store, time.Now())[0]
+
+	circuitOpen := func(at time.Time) bool {
+		t.Helper()
+		open, err := store.CircuitOpen("chat", at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return open
+	}
+
+	at := time.Now()
+	for i := 1; i <= CircuitThreshold; i++ {
+		if circuitOpen(at) {
+			t.Fatalf("circuit is open after %d failures", i-1)
+		}
+		if _, err := store.DeliveryFailed(entry, errors.New("refused"), at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !circuitOpen(at) || !circuitOpen(at.Add(CircuitCooldown-time.Second)) {
+		t.Fatal("circuit is closed after the threshold of failures")
+	}
+	if other, _ := store.CircuitOpen("oncall", at); other {
+		t.Error("circuit of another target is open")
+	}
+
+	// After the cooldown one attempt is allowed, its failure opens the circuit again
+	halfOpen := at.Add(CircuitCooldown)
+	if circuitOpen(halfOpen) {
+		t.Fatal("circuit is still open after the cooldown")
+	}
+	if _, err := store.DeliveryFailed(entry, errors.New("refused"), halfOpen); err != nil {
+		t.Fatal(err)
+	}
+	if !circuitOpen(halfOpen) || !circuitOpen(halfOpen.Add(CircuitCooldown-time.Second)) {
+		t.Fatal("half-open circuit is not opened again by a failure")
+	}
+
+	// A success closes it
+	if err := store.Delivered(entry, halfOpen); err != nil {
+		t.Fatal(err)
+	}
+	if circuitOpen(halfOpen) {
+		t.Error("circuit is open after a successful delivery")
+	}
+}
+
+func TestDeliveryFailedConfigError(t *testing.T) {
+	store := openTestStore(t)
+	enqueueTest(t, store, "orders", "hook", "2 new rows")
+	entry := dueOutbox(t, store, time.Now())[0]
+
+	at := time.Now()
+	for i := 0; i < CircuitThreshold; i++ {
+		dead, err := store.DeliveryFailed(entry, &ConfigError{Err: errors.New("webhook body is not valid JSON")}, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !dead {
+			t.Fatal("notification failing with a config error is retried")
+		}
+	}
+
+	dead, err := store.DeadLetters()
+	if err != nil || len(dead) != 1 || dead[0].Attempts != 1 || dead[0].LastError != "webhook body is not valid JSON" {
+		t.Fatalf("dead letters = %+v, %v", dead, err)
+	}
+	if open, err := store.CircuitOpen("hook", at); err != nil || open {
+		t.Errorf("config errors opened the circuit of the target: %v, %v", open, err)
+	}
+}
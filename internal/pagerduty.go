@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultPagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	pagerDutySummaryLimit     = 1024
+)
+
+type pagerDutyNotifier struct {
+	url        string
+	routingKey string
+	source     string
+	severity   string
+}
+
+type pagerDutyPayload struct {
+	Summary       string         `json:"summary"`
+	Source        string         `json:"source"`
+	Severity      string         `json:"severity"`
+	Timestamp     string         `json:"timestamp,omitempty"`
+	Component     string         `json:"component,omitempty"`
+	CustomDetails map[string]any `json:"custom_details,omitempty"`
+}
+
+type pagerDutyEvent struct {
+	RoutingKey  string            `json:"routing_key"`
+	EventAction string            `json:"event_action"`
+	DedupKey    string            `json:"dedup_key"`
+	Payload     *pagerDutyPayload `json:"payload,omitempty"`
+}
+
+func newPagerDutyNotifier(config *Config, query QueryConfig) (Notifier, error) {
+	pagerDuty := PagerDutyConfig{}
+	if config.PagerDuty != nil {
+		pagerDuty = *config.PagerDuty
+	}
+
+	routingKey := pagerDuty.RoutingKey
+	if query.PagerDutyRoutingKey != "" {
+		routingKey = query.PagerDutyRoutingKey
+	}
+	if routingKey == "" {
+		return nil, fmt.Errorf("pagerduty notifier of query %s needs routingKey", query.Name)
+	}
+
+	url := pagerDuty.EventsURL
+	if url == "" {
+		url = defaultPagerDutyEventsURL
+	}
+
+	// The connection name tells on-call which system is affected
+	source, err := config.QueryDatabase(query)
+	if err != nil {
+		return nil, err
+	}
+	// PagerDuty levels are the same as ours, anything else pages as critical
+	severity := config.QuerySeverity(query)
+	switch severity {
+	case SeverityCritical, SeverityError, SeverityWarning, SeverityInfo:
+	default:
+		severity = SeverityCritical
+	}
+
+	return pagerDutyNotifier{url: url, routingKey: routingKey, source: "sqlal/" + source, severity: severity}, nil
+}
+
+// pagerDutyDedupKey identifies the incident of a query, so repeated triggers are grouped
+// into the open incident and a resolve event closes it.
+func pagerDutyDedupKey(query string) string {
+	return "sqlal/" + query
+}
+
+// Notify sends a resolve event for resolved alerts and a trigger event for everything else.
+func (p pagerDutyNotifier) Notify(ctx context.Context, n Notification) error {
+	event := pagerDutyEvent{
+		RoutingKey:  p.routingKey,
+		EventAction: "trigger",
+		DedupKey:    pagerDutyDedupKey(n.Query),
+	}
+
+	if n.Status == AlertResolved {
+		event.EventAction = "resolve"
+	} else {
+		details := map[string]any{"rows": len(n.Rows)}
+		if len(n.Rows) > 0 && len(n.Columns) > 0 {
+			details["data"] = textTable(n.Columns, n.Rows)
+		}
+
+		event.Payload = &pagerDutyPayload{
+			Summary:       truncate(n.Message, pagerDutySummaryLimit),
+			Source:        p.source,
+			Severity:      p.severity,
+			Component:     n.Query,
+			CustomDetails: details,
+		}
+		if !n.Time.IsZero() {
+			event.Payload.Timestamp = n.Time.Format(time.RFC3339)
+		}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doRequest(req, http.StatusAccepted)
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestPagerDutyNotify(t *testing.T) {
+	server, requests := recordServer(t, http.StatusAccepted)
+	config := &Config{
+		Databases: map[string]DatabaseConfig{"shop": {}},
+		PagerDuty: &PagerDutyConfig{RoutingKey: "global", EventsURL: server.URL + "/v2/enqueue"},
+	}
+	query := QueryConfig{Name: "orders", Severity: SeverityWarning, TargetConfig: TargetConfig{Notifier: NotifierPagerDuty}}
+
+	n := testNotification()
+	n.Status = AlertFiring
+	if err := notify(t, config, query, n); err != nil {
+		t.Fatal(err)
+	}
+	n.Status = AlertResolved
+	if err := notify(t, config, query, n); err != nil {
+		t.Fatal(err)
+	}
+
+	got := requests()
+	if len(got) != 2 || got[0].Path != "/v2/enqueue" {
+		t.Fatalf("requests = %+v", got)
+	}
+	var trigger, resolve pagerDutyEvent
+	if err := json.Unmarshal([]byte(got[0].Body), &trigger); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(got[1].Body), &resolve); err != nil {
+		t.Fatal(err)
+	}
+
+	if trigger.EventAction != "trigger" || trigger.RoutingKey != "global" || trigger.DedupKey != "sqlal/orders" {
+		t.Errorf("trigger = %+v", trigger)
+	}
+	payload := trigger.Payload
+	if payload == nil {
+		t.Fatal("trigger has no payload")
+	}
+	if payload.Summary != n.Message || payload.Source != "sqlal/shop" || payload.Severity != SeverityWarning ||
+		payload.Component != "orders" || payload.Timestamp != "2024-05-01T10:00:00Z" {
+		t.Errorf("payload = %+v", payload)
+	}
+	if payload.CustomDetails["rows"] != float64(2) || payload.CustomDetails["data"] != textTable(n.Columns, n.Rows) {
+		t.Errorf("custom details = %v", payload.CustomDetails)
+	}
+
+	// The resolve event closes the incident of the trigger
+	if resolve.EventAction != "resolve" || resolve.DedupKey != trigger.DedupKey || resolve.Payload != nil {
+		t.Errorf("resolve = %+v", resolve)
+	}
+}
+
+func TestPagerDutySettings(t *testing.T) {
+	config := &Config{Databases: map[string]DatabaseConfig{"default": {}}, PagerDuty: &PagerDutyConfig{RoutingKey: "global"}}
+	tests := []struct {
+		query        QueryConfig
+		wantKey      string
+		wantSeverity string
+	}{
+		{QueryConfig{Name: "orders"}, "global", SeverityCritical},
+		{QueryConfig{Name: "orders", Severity: SeverityInfo}, "global", SeverityInfo},
+		{QueryConfig{Name: "orders", Severity: "page-everyone"}, "global", SeverityCritical},
+		{QueryConfig{Name: "orders", TargetConfig: TargetConfig{PagerDutyRoutingKey: "own"}}, "own", SeverityCritical},
+	}
+	for _, tt := range tests {
+		tt.query.Notifier = NotifierPagerDuty
+		notifier, err := NewNotifier(config, tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := notifier.(pagerDutyNotifier)
+		if p.routingKey != tt.wantKey || p.severity != tt.wantSeverity || p.url != defaultPagerDutyEventsURL || p.source != "sqlal/default" {
+			t.Errorf("severity %q: notifier = %+v", tt.query.Severity, p)
+		}
+	}
+
+	if _, err := NewNotifier(&Config{}, QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierPagerDuty}}); err == nil {
+		t.Error("pagerduty notifier without routing key was built")
+	}
+}
@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Target is a resolved notification target. Own settings of a query are named "query:<name>".
+type Target struct {
+	Name string
+	TargetConfig
+}
+
+// QueryTargets resolves where a notification goes: targets listed by the query, targets of matching
+// routes and the query's own settings. The own settings are used when they set a notifier or URL,
+// or when nothing else is selected, so queries without targets keep the default ntfy behaviour.
+func (c *Config) QueryTargets(query QueryConfig, n Notification) ([]Target, error) {
+	return c.queryTargets(query, len(n.Rows))
+}
+
+// CheckQueryTargets resolves every target notifications of the query may go to, whatever
+// number of rows they have, and builds their notifiers, so unknown targets and incomplete
+// notifier settings are found at startup instead of the first alert.
+func (c *Config) CheckQueryTargets(query QueryConfig) error {
+	// Routes select more targets with more rows, the least and the most rows cover all of them
+	for _, rows := range []int{0, math.MaxInt} {
+		targets, err := c.queryTargets(query, rows)
+		if err != nil {
+			return err
+		}
+		for _, target := range targets {
+			if _, err := NewNotifier(c, query.WithTarget(target)); err != nil {
+				return fmt.Errorf("target %s: %w", target.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) queryTargets(query QueryConfig, rows int) ([]Target, error) {
+	names := slices.Clone(query.Targets)
+	for _, route := range c.Routes {
+		if route.matches(query, c.QuerySeverity(query), rows) {
+			names = append(names, route.Targets...)
+		}
+	}
+
+	var targets []Target
+	if query.Notifier != "" || query.NotificationURL != "" || len(names) == 0 {
+		targets = append(targets, Target{Name: ownTargetName(query), TargetConfig: query.TargetConfig})
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		target, ok := c.Targets[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown target %q of query %s", name, query.Name)
+		}
+		targets = append(targets, Target{Name: name, TargetConfig: target.TargetConfig})
+	}
+	return targets, nil
+}
+
+// QueryTarget finds a target of the query by name, including the query's own one.
+func (c *Config) QueryTarget(query QueryConfig, name string) (Target, error) {
+	if name == ownTargetName(query) {
+		return Target{Name: name, TargetConfig: query.TargetConfig}, nil
+	}
+
+	target, ok := c.Targets[name]
+	if !ok {
+		return Target{}, fmt.Errorf("unknown target %q of query %s", name, query.Name)
+	}
+	return Target{Name: name, TargetConfig: target.TargetConfig}, nil
+}
+
+// TargetsByName resolves targets of the query chosen before, e.g. the ones its firing
+// notification went to. Targets removed from config since then are skipped.
+func (c *Config) TargetsByName(query QueryConfig, names []string) []Target {
+	var targets []Target
+	for _, name := range names {
+		if target, err := c.QueryTarget(query, name); err == nil {
+			targets = append(targets, target)
+		}
+	}
+	return targets
+}
+
+func ownTargetName(query QueryConfig) string {
+	return "query:" + query.Name
+}
+
+func (r RouteConfig) matches(query QueryConfig, severity string, rows int) bool {
+	if len(r.Tags) > 0 && !slices.ContainsFunc(query.Tags, func(tag string) bool { return slices.Contains(r.Tags, tag) }) {
+		return false
+	}
+	if len(r.Severity) > 0 && !slices.Contains(r.Severity, severity) {
+		return false
+	}
+	return rows >= r.MinRows
+}
+
+// WithTarget returns the query sending to the target instead of its own settings.
+func (q QueryConfig) WithTarget(target Target) QueryConfig {
+	q.TargetConfig = target.TargetConfig
+	return q
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func targetNames(targets []Target) []string {
+	names := make([]string, len(targets))
+	for i, target := range targets {
+		names[i] = target.Name
+	}
+	return names
+}
+
+func TestRouteMatches(t *testing.T) {
+	query := QueryConfig{Name: "orders", Tags: []string{"shop", "billing"}}
+	tests := []struct {
+		name     string
+		route    RouteConfig
+		severity string
+		rows     int
+		want     bool
+	}{
+		{"empty", RouteConfig{}, SeverityInfo, 0, true},
+		{"tag", RouteConfig{Tags: []string{"ops", "billing"}}, SeverityInfo, 0, true},
+		{"other tag", RouteConfig{Tags: []string{"ops"}}, SeverityInfo, 0, false},
+		{"severity", RouteConfig{Severity: []string{SeverityCritical, SeverityError}}, SeverityError, 0, true},
+		{"other severity", RouteConfig{Severity: []string{SeverityCritical}}, SeverityWarning, 0, false},
+		{"enough rows", RouteConfig{MinRows: 10}, SeverityInfo, 10, true},
+		{"too few rows", RouteConfig{MinRows: 10}, SeverityInfo, 9, false},
+		{"all conditions", RouteConfig{Tags: []string{"shop"}, Severity: []string{SeverityInfo}, MinRows: 1}, SeverityInfo, 1, true},
+		{"one condition fails", RouteConfig{Tags: []string{"shop"}, Severity: []string{SeverityInfo}, MinRows: 2}, SeverityInfo, 1, false},
+	}
+	for _, tt := range tests {
+		if got := tt.route.matches(query, tt.severity, tt.rows); got != tt.want {
+			t.Errorf("%s: matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQueryTargets(t *testing.T) {
+	config := &Config{
+		Targets: map[string]NamedTarget{
+			"chat":   {TargetConfig: TargetConfig{Notifier: NotifierSlack, NotificationURL: "https://hooks.slack.com/services/T/B/X"}},
+			"oncall": {TargetConfig: TargetConfig{Notifier: NotifierPagerDuty, PagerDutyRoutingKey: "key"}},
+			"mail":   {TargetConfig: TargetConfig{Notifier: NotifierEmail, EmailTo: []string{"ops@example.com"}}},
+		},
+		Routes: []RouteConfig{
+			{Tags: []string{"shop"}, Targets: []string{"chat"}},
+			{Severity: []string{SeverityCritical}, MinRows: 100, Targets: []string{"oncall", "chat"}},
+		},
+	}
+	many := Notification{Rows: make([]map[string]string, 100)}
+
+	tests := []struct {
+		name  string
+		query QueryConfig
+		n     Notification
+		want  []string
+	}{
+		{"own settings by default", QueryConfig{Name: "orders"}, Notification{}, []string{"query:orders"}},
+		{"listed targets", QueryConfig{Name: "orders", Targets: []string{"mail"}}, Notification{}, []string{"mail"}},
+		{"own settings with targets", QueryConfig{Name: "orders", Targets: []string{"mail"}, TargetConfig: TargetConfig{NotificationURL: "https://ntfy.sh/orders"}},
+			Notification{}, []string{"query:orders", "mail"}},
+		{"route by tag", QueryConfig{Name: "orders", Tags: []string{"shop"}}, Notification{}, []string{"chat"}},
+		{"route by rows", QueryConfig{Name: "orders", Tags: []string{"shop"}, Targets: []string{"mail"}}, many, []string{"mail", "chat", "oncall"}},
+		{"route by severity", QueryConfig{Name: "orders", Severity: SeverityWarning}, many, []string{"query:orders"}},
+	}
+	for _, tt := range tests {
+		targets, err := config.QueryTargets(tt.query, tt.n)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := targetNames(targets); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: targets = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	targets, _ := config.QueryTargets(QueryConfig{Name: "orders", Targets: []string{"chat"}}, Notification{})
+	if targets[0].Notifier != NotifierSlack || targets[0].NotificationURL == "" {
+		t.Errorf("target settings = %+v", targets[0].TargetConfig)
+	}
+	if _, err := config.QueryTargets(QueryConfig{Name: "orders", Targets: []string{"pager"}}, Notification{}); err == nil {
+		t.Error("unknown target was resolved")
+	}
+}
+
+func TestTargetsByName(t *testing.T) {
+	config := &Config{Targets: map[string]NamedTarget{"chat": {TargetConfig: TargetConfig{Notifier: NotifierSlack}}}}
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{NotificationURL: "https://ntfy.sh/orders"}}
+
+	targets := config.TargetsByName(query, []string{"query:orders", "removed", "chat"})
+	if got := targetNames(targets); !slices.Equal(got, []string{"query:orders", "chat"}) {
+		t.Fatalf("targets = %v, want the own one and chat", got)
+	}
+	if targets[0].NotificationURL != "https://ntfy.sh/orders" || targets[1].Notifier != NotifierSlack {
+		t.Errorf("targets = %+v", targets)
+	}
+	if targets := config.TargetsByName(query, nil); len(targets) != 0 {
+		t.Errorf("targets without names = %v", targets)
+	}
+}
+
+func TestCheckQueryTargets(t *testing.T) {
+	config := &Config{
+		BaseNotificationURL: "https://ntfy.sh/sqlal",
+		Targets: map[string]NamedTarget{
+			"chat":   {TargetConfig: TargetConfig{Notifier: NotifierSlack, NotificationURL: "https://hooks.slack.com/services/T/B/X"}},
+			"nourl":  {TargetConfig: TargetConfig{Notifier: NotifierSlack}},
+			"noaddr": {TargetConfig: TargetConfig{Notifier: NotifierEmail}},
+		},
+		Routes: []RouteConfig{
+			{Tags: []string{"shop"}, Targets: []string{"chat"}},
+			{Tags: []string{"big"}, MinRows: 1000, Targets: []string{"pager"}},
+		},
+	}
+	tests := []struct {
+		name    string
+		query   QueryConfig
+		wantErr string
+	}{
+		{"default ntfy", QueryConfig{Name: "orders"}, ""},
+		{"routed", QueryConfig{Name: "orders", Tags: []string{"shop"}}, ""},
+		{"unknown listed target", QueryConfig{Name: "orders", Targets: []string{"pager"}}, `unknown target "pager"`},
+		{"unknown target of a route with many rows", QueryConfig{Name: "orders", Tags: []string{"big"}}, `unknown target "pager"`},
+		{"target without url", QueryConfig{Name: "orders", Targets: []string{"nourl"}}, "target nourl: slack notifier of query orders needs notificationUrl"},
+		{"target without addresses", QueryConfig{Name: "orders", Targets: []string{"noaddr"}}, "target noaddr:"},
+		{"own settings", QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierTeams}}, "target query:orders:"},
+	}
+	for _, tt := range tests {
+		err := config.CheckQueryTargets(tt.query)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
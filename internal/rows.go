@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Row is a single query result with its identity used for deduplication.
+type Row struct {
+	Key    string
+	Values map[string]string
+}
+
+// ScanRows reads every column of the result as text. The row key is built from
+// keyColumns, or from the first column when none are configured. Composite keys
+// are encoded as JSON arrays so that ("a,b", "c") and ("a", "b,c") never collide.
+func ScanRows(rows *sql.Rows, keyColumns []string) ([]string, []Row, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(columns) == 0 {
+		return nil, nil, fmt.Errorf("query returned no columns")
+	}
+
+	if len(keyColumns) == 0 {
+		keyColumns = columns[:1]
+	}
+	for _, keyColumn := range keyColumns {
+		if !containsString(columns, keyColumn) {
+			return nil, nil, fmt.Errorf("key column %q is not in query result %v", keyColumn, columns)
+		}
+	}
+
+	var result []Row
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+
+		row := Row{Values: make(map[string]string, len(columns))}
+		for i, column := range columns {
+			row.Values[column] = values[i].String
+		}
+
+		row.Key, err = rowKey(row.Values, keyColumns)
+		if err != nil {
+			return nil, nil, err
+		}
+		result = append(result, row)
+	}
+
+	return columns, result, rows.Err()
+}
+
+func rowKey(values map[string]string, keyColumns []string) (string, error) {
+	if len(keyColumns) == 1 {
+		return values[keyColumns[0]], nil
+	}
+
+	parts := make([]string, len(keyColumns))
+	for i, keyColumn := range keyColumns {
+		parts[i] = values[keyColumn]
+	}
+	key, err := json.Marshal(parts)
+	return string(key), err
+}
+
+func containsString(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
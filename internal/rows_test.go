@@ -0,0 +1,38 @@
+package internal
+
+import "testing"
+
+func TestRowKey(t *testing.T) {
+	values := map[string]string{"id": "7", "tenant": "a,b", "region": "c", "empty": ""}
+
+	tests := []struct {
+		name       string
+		keyColumns []string
+		want       string
+	}{
+		{"single", []string{"id"}, "7"},
+		{"single empty", []string{"empty"}, ""},
+		{"composite", []string{"tenant", "id"}, `["a,b","7"]`},
+		{"composite order", []string{"id", "tenant"}, `["7","a,b"]`},
+		{"missing column", []string{"id", "missing"}, `["7",""]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rowKey(values, tt.keyColumns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("rowKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRowKeyNoCollision(t *testing.T) {
+	a, _ := rowKey(map[string]string{"x": "a,b", "y": "c"}, []string{"x", "y"})
+	b, _ := rowKey(map[string]string{"x": "a", "y": "b,c"}, []string{"x", "y"})
+	if a == b {
+		t.Errorf("composite keys collide: %q", a)
+	}
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultQueryTimeout = 30 * time.Second
+)
+
+// QuerySchedule returns when the query should run: its cron expression, its own
+// interval or the global check interval, in that order.
+func (c *Config) QuerySchedule(query QueryConfig) (cron.Schedule, error) {
+	if query.Cron != "" {
+		schedule, err := cron.ParseStandard(query.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("cron of query %s: %w", query.Name, err)
+		}
+		return schedule, nil
+	}
+
+	interval := time.Duration(c.CheckIntervalSeconds) * time.Second
+	if query.Interval != "" {
+		var err error
+		interval, err = time.ParseDuration(query.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("interval of query %s: %w", query.Name, err)
+		}
+	}
+	if interval < time.Second {
+		return nil, fmt.Errorf("interval of query %s must be at least one second", query.Name)
+	}
+	return cron.Every(interval), nil
+}
+
+// QueryTimeout returns how long a single run of the query may take.
+func (c *Config) QueryTimeout(query QueryConfig) (time.Duration, error) {
+	if query.Timeout != "" {
+		timeout, err := time.ParseDuration(query.Timeout)
+		if err != nil {
+			return 0, fmt.Errorf("timeout of query %s: %w", query.Name, err)
+		}
+		return timeout, nil
+	}
+
+	if c.QueryTimeoutSeconds > 0 {
+		return time.Duration(c.QueryTimeoutSeconds) * time.Second, nil
+	}
+	return defaultQueryTimeout, nil
+}
+
+// WorkerCount returns how many queries may run at the same time.
+func (c *Config) WorkerCount() int {
+	if c.Workers > 0 {
+		return c.Workers
+	}
+	return defaultWorkers
+}
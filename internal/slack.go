@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Slack rejects section texts longer than 3000 characters
+const slackTextLimit = 3000
+
+// Slack treats only these characters as control sequences in mrkdwn
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+type slackNotifier struct {
+	url string
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+// Notify posts a Block Kit message to a Slack incoming webhook:
+// query name as header, the message, rows count and a table of rows.
+func (s slackNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(slackPayload(n))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doRequest(req, http.StatusOK)
+}
+
+func slackPayload(n Notification) slackMessage {
+	fields := []slackText{{Type: "mrkdwn", Text: fmt.Sprintf("*Rows*\n%d", len(n.Rows))}}
+	if n.Status != "" {
+		fields = append(fields, slackText{Type: "mrkdwn", Text: fmt.Sprintf("*Status*\n%s", n.Status)})
+	}
+
+	blocks := []slackBlock{
+		{Type: "header", Text: &slackText{Type: "plain_text", Text: truncate(n.Query, 150)}},
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: truncate(slackEscaper.Replace(n.Message), slackTextLimit)}},
+		{Type: "section", Fields: fields},
+	}
+	if len(n.Rows) > 0 && len(n.Columns) > 0 {
+		table := truncate(slackEscaper.Replace(textTable(n.Columns, n.Rows)), slackTextLimit-6)
+		blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "```" + table + "```"}})
+	}
+
+	return slackMessage{Text: truncate(n.Message, slackTextLimit), Blocks: blocks}
+}
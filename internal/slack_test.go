@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSlackNotify(t *testing.T) {
+	server, requests := recordServer(t, http.StatusOK)
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierSlack, NotificationURL: server.URL + "/services/T/B/X"}}
+	n := testNotification()
+	n.Status = AlertFiring
+	if err := notify(t, &Config{}, query, n); err != nil {
+		t.Fatal(err)
+	}
+
+	got := requests()
+	if len(got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(got))
+	}
+	if got[0].Method != http.MethodPost || got[0].Path != "/services/T/B/X" {
+		t.Errorf("request %s %s, want POST /services/T/B/X", got[0].Method, got[0].Path)
+	}
+	if ct := got[0].Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var message slackMessage
+	if err := json.Unmarshal([]byte(got[0].Body), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Text != n.Message {
+		t.Errorf("text = %q, want %q", message.Text, n.Message)
+	}
+	if len(message.Blocks) != 4 {
+		t.Fatalf("got %d blocks, want header, message, fields and table", len(message.Blocks))
+	}
+	if header := message.Blocks[0]; header.Type != "header" || header.Text.Text != "orders" {
+		t.Errorf("header block = %+v", header)
+	}
+	if text := message.Blocks[1].Text.Text; text != "orders: 2 new &lt;rows&gt;" {
+		t.Errorf("message is not escaped: %q", text)
+	}
+	fields := message.Blocks[2].Fields
+	if len(fields) != 2 || fields[0].Text != "*Rows*\n2" || fields[1].Text != "*Status*\nfiring" {
+		t.Errorf("fields = %+v", fields)
+	}
+	if table := message.Blocks[3].Text.Text; !strings.HasPrefix(table, "```") || !strings.Contains(table, "b@example.com") {
+		t.Errorf("table block = %q", table)
+	}
+}
+
+func TestSlackPayloadLimits(t *testing.T) {
+	n := testNotification()
+	n.Message = strings.Repeat("x", 5000)
+	n.Rows = nil
+
+	message := slackPayload(n)
+	if len(message.Blocks) != 3 {
+		t.Errorf("got %d blocks without rows, want 3", len(message.Blocks))
+	}
+	if l := len([]rune(message.Blocks[1].Text.Text)); l > slackTextLimit {
+		t.Errorf("section text has %d characters, limit is %d", l, slackTextLimit)
+	}
+}
@@ -0,0 +1,502 @@
+package internal
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	processedFileSuffix = "_processed_ids.txt"
+	cursorFileSuffix    = "_cursor.txt"
+)
+
+var stateSchema = []string{
+	`CREATE TABLE IF NOT EXISTS processed (
+		query   TEXT    NOT NULL,
+		key     TEXT    NOT NULL,
+		seen_at INTEGER NOT NULL,
+		PRIMARY KEY (query, key)
+	) WITHOUT ROWID`,
+	`CREATE INDEX IF NOT EXISTS processed_seen_at ON processed (seen_at)`,
+	`CREATE TABLE IF NOT EXISTS cursors (
+		query      TEXT    NOT NULL PRIMARY KEY,
+		value      TEXT    NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS alerts (
+		query TEXT    NOT NULL PRIMARY KEY,
+		state TEXT    NOT NULL,
+		since INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS alert_targets (
+		query   TEXT NOT NULL PRIMARY KEY,
+		targets TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS incidents (
+		id          INTEGER PRIMARY KEY AUTOINCREMENT,
+		query       TEXT    NOT NULL,
+		started_at  INTEGER NOT NULL,
+		resolved_at INTEGER
+	)`,
+	`CREATE INDEX IF NOT EXISTS incidents_query ON incidents (query, resolved_at)`,
+	`CREATE TABLE IF NOT EXISTS snapshots (
+		query  TEXT NOT NULL,
+		key    TEXT NOT NULL,
+		vals   TEXT NOT NULL,
+		PRIMARY KEY (query, key)
+	) WITHOUT ROWID`,
+	`CREATE TABLE IF NOT EXISTS snapshot_taken (
+		query    TEXT    NOT NULL PRIMARY KEY,
+		taken_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS activity (
+		query        TEXT    NOT NULL PRIMARY KEY,
+		last_seen_at INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS outbox (
+		id              INTEGER PRIMARY KEY AUTOINCREMENT,
+		idempotency_key TEXT    NOT NULL UNIQUE,
+		query           TEXT    NOT NULL,
+		target          TEXT    NOT NULL,
+		notification    TEXT    NOT NULL,
+		attempts        INTEGER NOT NULL DEFAULT 0,
+		last_error      TEXT    NOT NULL DEFAULT '',
+		created_at      INTEGER NOT NULL,
+		next_attempt_at INTEGER NOT NULL,
+		dead            INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE INDEX IF NOT EXISTS outbox_due ON outbox (dead, next_attempt_at)`,
+	`CREATE TABLE IF NOT EXISTS circuits (
+		target     TEXT    NOT NULL PRIMARY KEY,
+		failures   INTEGER NOT NULL,
+		open_until INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS sends (
+		kind    TEXT    NOT NULL,
+		name    TEXT    NOT NULL,
+		sent_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS sends_name ON sends (kind, name, sent_at)`,
+	`CREATE TABLE IF NOT EXISTS held (
+		query         TEXT    NOT NULL PRIMARY KEY,
+		reason        TEXT    NOT NULL,
+		notifications INTEGER NOT NULL,
+		rows          INTEGER NOT NULL,
+		since         INTEGER NOT NULL,
+		release_at    INTEGER NOT NULL,
+		last          TEXT    NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS maintenance (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		query     TEXT    NOT NULL,
+		action    TEXT    NOT NULL,
+		reason    TEXT    NOT NULL,
+		starts_at INTEGER NOT NULL,
+		ends_at   INTEGER NOT NULL
+	)`,
+}
+
+// Alert lifecycle of condition based queries: ok → firing → resolved → firing → ...
+const (
+	AlertOK       = "ok"
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertState is the last known condition of a query and when it was entered.
+type AlertState struct {
+	State string
+	Since time.Time
+}
+
+// Incident is a single firing period of a query.
+type Incident struct {
+	Query      string
+	StartedAt  time.Time
+	ResolvedAt time.Time
+}
+
+func (i Incident) Duration() time.Duration {
+	return i.ResolvedAt.Sub(i.StartedAt)
+}
+
+// StateStore keeps everything sqlal remembers between runs in an embedded SQLite database.
+type StateStore struct {
+	db *sql.DB
+}
+
+// StateTx changes the state within a transaction of StateStore.Update.
+type StateTx struct {
+	tx *sql.Tx
+}
+
+func OpenStateStore(path string) (*StateStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer anyway, one connection avoids SQLITE_BUSY between our own goroutines
+	db.SetMaxOpenConns(1)
+
+	for _, stmt := range stateSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("state store schema: %w", err)
+		}
+	}
+
+	return &StateStore{db: db}, nil
+}
+
+func (s *StateStore) Close() error {
+	return s.db.Close()
+}
+
+// Update runs fn in a transaction, so state changes of a run and notifications queued
+// for them are stored together or not at all. Only tx may be used inside fn: the store
+// has a single connection which is busy with the transaction.
+func (s *StateStore) Update(fn func(tx *StateTx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&StateTx{tx: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// processedBatch is how many keys are looked up by one query, well below the SQLite variable limit.
+const processedBatch = 500
+
+// ProcessedKeys returns when each of the keys was last seen, keys never processed are missing.
+func (s *StateStore) ProcessedKeys(query string, keys []string) (map[string]time.Time, error) {
+	seen := make(map[string]time.Time)
+	for start := 0; start < len(keys); start += processedBatch {
+		batch := keys[start:min(start+processedBatch, len(keys))]
+
+		args := make([]any, 0, len(batch)+1)
+		args = append(args, query)
+		for _, key := range batch {
+			args = append(args, key)
+		}
+		rows, err := s.db.Query(`SELECT key, seen_at FROM processed WHERE query = ? AND key IN (?`+
+			strings.Repeat(", ?", len(batch)-1)+`)`, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var key string
+			var seenAt int64
+			if err := rows.Scan(&key, &seenAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			seen[key] = time.Unix(seenAt, 0)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return seen, nil
+}
+
+func (s *StateStore) MarkProcessed(query string, keys []string) error {
+	return s.Update(func(tx *StateTx) error {
+		return tx.MarkProcessed(query, keys)
+	})
+}
+
+// MarkProcessed remembers keys as seen now. Keys processed before get their time refreshed,
+// so retention forgets only keys which are no longer returned by the query.
+func (t *StateTx) MarkProcessed(query string, keys []string) error {
+	stmt, err := t.tx.Prepare(`INSERT INTO processed (query, key, seen_at) VALUES (?, ?, ?)
+		ON CONFLICT (query, key) DO UPDATE SET seen_at = excluded.seen_at`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	seenAt := time.Now().Unix()
+	for _, key := range keys {
+		if _, err := stmt.Exec(query, key, seenAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Cursor returns the last seen value of a cursor mode query, empty if the query never ran.
+func (s *StateStore) Cursor(query string) (string, error) {
+	var value string
+	err := s.db.QueryRow(`SELECT value FROM cursors WHERE query = ?`, query).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return value, err
+}
+
+func (s *StateStore) SetCursor(query, value string) error {
+	return s.Update(func(tx *StateTx) error {
+		return tx.SetCursor(query, value)
+	})
+}
+
+func (t *StateTx) SetCursor(query, value string) error {
+	_, err := t.tx.Exec(`INSERT INTO cursors (query, value, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (query) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		query, value, time.Now().Unix())
+	return err
+}
+
+// AlertState returns the stored condition of the query, "ok" if it never fired.
+func (t *StateTx) AlertState(query string) (AlertState, error) {
+	var state string
+	var since int64
+	err := t.tx.QueryRow(`SELECT state, since FROM alerts WHERE query = ?`, query).Scan(&state, &since)
+	if err == sql.ErrNoRows {
+		return AlertState{State: AlertOK}, nil
+	}
+	if err != nil {
+		return AlertState{}, err
+	}
+	return AlertState{State: state, Since: time.Unix(since, 0)}, nil
+}
+
+// Snapshot returns the result a diff query had on its previous run by row key.
+// It reports false when no snapshot was stored yet, an empty previous result is a stored one.
+func (s *StateStore) Snapshot(query string) (map[string]Row, bool, error) {
+	var taken int
+	err := s.db.QueryRow(`SELECT 1 FROM snapshot_taken WHERE query = ?`, query).Scan(&taken)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	rows, err := s.db.Query(`SELECT key, vals FROM snapshots WHERE query = ?`, query)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	snapshot := make(map[string]Row)
+	for rows.Next() {
+		var key, vals string
+		if err := rows.Scan(&key, &vals); err != nil {
+			return nil, false, err
+		}
+
+		row := Row{Key: key}
+		if err := json.Unmarshal([]byte(vals), &row.Values); err != nil {
+			return nil, false, err
+		}
+		snapshot[key] = row
+	}
+	return snapshot, true, rows.Err()
+}
+
+// ReplaceSnapshot stores the current result of a diff query instead of the previous one.
+func (t *StateTx) ReplaceSnapshot(query string, result []Row) error {
+	if _, err := t.tx.Exec(`DELETE FROM snapshots WHERE query = ?`, query); err != nil {
+		return err
+	}
+	_, err := t.tx.Exec(`INSERT INTO snapshot_taken (query, taken_at) VALUES (?, ?)
+		ON CONFLICT (query) DO UPDATE SET taken_at = excluded.taken_at`, query, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	stmt, err := t.tx.Prepare(`INSERT OR REPLACE INTO snapshots (query, key, vals) VALUES (?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, row := range result {
+		vals, err := json.Marshal(row.Values)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(query, row.Key, string(vals)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LastActivity returns when new rows of the query were last seen, zero time if never.
+func (s *StateStore) LastActivity(query string) (time.Time, error) {
+	var lastSeen int64
+	err := s.db.QueryRow(`SELECT last_seen_at FROM activity WHERE query = ?`, query).Scan(&lastSeen)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(lastSeen, 0), nil
+}
+
+func (t *StateTx) SetLastActivity(query string, at time.Time) error {
+	_, err := t.tx.Exec(`INSERT INTO activity (query, last_seen_at) VALUES (?, ?)
+		ON CONFLICT (query) DO UPDATE SET last_seen_at = excluded.last_seen_at`, query, at.Unix())
+	return err
+}
+
+// FireAlert switches the query to firing and opens a new incident.
+func (t *StateTx) FireAlert(query string, at time.Time) error {
+	if err := setAlertState(t.tx, query, AlertState{State: AlertFiring, Since: at}); err != nil {
+		return err
+	}
+	_, err := t.tx.Exec(`INSERT INTO incidents (query, started_at) VALUES (?, ?)`, query, at.Unix())
+	return err
+}
+
+// ResolveAlert switches the query to resolved and closes its open incident.
+func (t *StateTx) ResolveAlert(query string, at time.Time) (Incident, error) {
+	tx := t.tx
+
+	var id, startedAt int64
+	err := tx.QueryRow(`SELECT id, started_at FROM incidents WHERE query = ? AND resolved_at IS NULL
+		ORDER BY id DESC LIMIT 1`, query).Scan(&id, &startedAt)
+	if err != nil {
+		return Incident{}, err
+	}
+	if _, err := tx.Exec(`UPDATE incidents SET resolved_at = ? WHERE id = ?`, at.Unix(), id); err != nil {
+		return Incident{}, err
+	}
+	incident := Incident{Query: query, StartedAt: time.Unix(startedAt, 0), ResolvedAt: at}
+
+	if err := setAlertState(tx, query, AlertState{State: AlertResolved, Since: at}); err != nil {
+		return Incident{}, err
+	}
+	return incident, nil
+}
+
+// SetAlertTargets remembers names of targets the firing notification of the query went to.
+func (t *StateTx) SetAlertTargets(query string, targets []string) error {
+	data, err := json.Marshal(targets)
+	if err != nil {
+		return err
+	}
+	_, err = t.tx.Exec(`INSERT INTO alert_targets (query, targets) VALUES (?, ?)
+		ON CONFLICT (query) DO UPDATE SET targets = excluded.targets`, query, string(data))
+	return err
+}
+
+// AlertTargets returns names of targets the last firing notification of the query went to.
+func (t *StateTx) AlertTargets(query string) ([]string, error) {
+	var data string
+	err := t.tx.QueryRow(`SELECT targets FROM alert_targets WHERE query = ?`, query).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []string
+	if err := json.Unmarshal([]byte(data), &targets); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+func setAlertState(tx *sql.Tx, query string, alert AlertState) error {
+	_, err := tx.Exec(`INSERT INTO alerts (query, state, since) VALUES (?, ?, ?)
+		ON CONFLICT (query) DO UPDATE SET state = excluded.state, since = excluded.since`,
+		query, alert.State, alert.Since.Unix())
+	return err
+}
+
+// Prune forgets processed keys seen before the given time and returns how many were removed.
+func (s *StateStore) Prune(before time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM processed WHERE seen_at < ?`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ImportProcessedDir moves state kept by older versions in plain text files into the store.
+// Every imported file is renamed with ".migrated" suffix so it is never imported twice.
+func (s *StateStore) ImportProcessedDir(directory string) (int, error) {
+	entries, err := os.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		filePath := filepath.Join(directory, name)
+
+		switch {
+		case strings.HasSuffix(name, processedFileSuffix):
+			err = s.importProcessedFile(strings.TrimSuffix(name, processedFileSuffix), filePath)
+		case strings.HasSuffix(name, cursorFileSuffix):
+			err = s.importCursorFile(strings.TrimSuffix(name, cursorFileSuffix), filePath)
+		default:
+			continue
+		}
+		if err != nil {
+			return imported, fmt.Errorf("import %s: %w", name, err)
+		}
+
+		if err := os.Rename(filePath, filePath+".migrated"); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+func (s *StateStore) importProcessedFile(query, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return s.MarkProcessed(query, keys)
+}
+
+func (s *StateStore) importCursorFile(query, filePath string) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return nil
+	}
+	return s.SetCursor(query, value)
+}
@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func processedKeys(t *testing.T, store *StateStore, query string, keys ...string) map[string]time.Time {
+	t.Helper()
+	seen, err := store.ProcessedKeys(query, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return seen
+}
+
+func TestImportProcessedDir(t *testing.T) {
+	store := openTestStore(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"orders_processed_ids.txt": "1\n2\n\n 3 \n",
+		"events_cursor.txt":        "2024-05-01 10:00:00\n",
+		"empty_cursor.txt":         "",
+		"notes.txt":                "not state",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	imported, err := store.ImportProcessedDir(dir)
+	if err != nil || imported != 3 {
+		t.Fatalf("ImportProcessedDir() = %d, %v, want 3", imported, err)
+	}
+	if seen := processedKeys(t, store, "orders", "1", "2", "3", "4"); len(seen) != 3 {
+		t.Errorf("imported keys = %v, want 1, 2 and 3", seen)
+	}
+	if cursor, err := store.Cursor("events"); err != nil || cursor != "2024-05-01 10:00:00" {
+		t.Errorf("imported cursor = %q, %v", cursor, err)
+	}
+	if cursor, _ := store.Cursor("empty"); cursor != "" {
+		t.Errorf("empty cursor file imported as %q", cursor)
+	}
+
+	for name := range files {
+		_, errOld := os.Stat(filepath.Join(dir, name))
+		_, errMigrated := os.Stat(filepath.Join(dir, name+".migrated"))
+		if name == "notes.txt" {
+			if errOld != nil || errMigrated == nil {
+				t.Errorf("unrelated file %s was moved", name)
+			}
+			continue
+		}
+		if !os.IsNotExist(errOld) || errMigrated != nil {
+			t.Errorf("%s was not renamed to .migrated", name)
+		}
+	}
+
+	// Later starts find only migrated files
+	if err := store.SetCursor("events", "2024-06-01 00:00:00"); err != nil {
+		t.Fatal(err)
+	}
+	imported, err = store.ImportProcessedDir(dir)
+	if err != nil || imported != 0 {
+		t.Fatalf("second ImportProcessedDir() = %d, %v, want 0", imported, err)
+	}
+	if cursor, _ := store.Cursor("events"); cursor != "2024-06-01 00:00:00" {
+		t.Errorf("second import changed the cursor to %q", cursor)
+	}
+
+	if imported, err := store.ImportProcessedDir(filepath.Join(dir, "missing")); err != nil || imported != 0 {
+		t.Errorf("ImportProcessedDir() of a missing directory = %d, %v", imported, err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	store := openTestStore(t)
+	for _, query := range []string{"orders", "events"} {
+		if err := store.MarkProcessed(query, []string{"a", "b", "c"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.db.Exec(`UPDATE processed SET seen_at = ?`, time.Now().AddDate(0, 0, -10).Unix()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys still returned are refreshed, the rest is forgotten
+	if err := store.MarkProcessed("orders", []string{"b"}); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := store.Prune(time.Now().AddDate(0, 0, -5))
+	if err != nil || removed != 5 {
+		t.Fatalf("Prune() = %d, %v, want 5", removed, err)
+	}
+	if seen := processedKeys(t, store, "orders", "a", "b", "c"); len(seen) != 1 || seen["b"].IsZero() {
+		t.Errorf("keys left = %v, want only b", seen)
+	}
+	if seen := processedKeys(t, store, "events", "a", "b", "c"); len(seen) != 0 {
+		t.Errorf("keys left of another query = %v", seen)
+	}
+}
+
+func TestProcessedKeysBatches(t *testing.T) {
+	store := openTestStore(t)
+	var keys []string
+	for i := 0; i < 2*processedBatch+10; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	if err := store.MarkProcessed("orders", keys[:processedBatch+5]); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := processedKeys(t, store, "orders", keys...)
+	if len(seen) != processedBatch+5 {
+		t.Fatalf("got %d processed keys, want %d", len(seen), processedBatch+5)
+	}
+	if _, ok := seen[keys[processedBatch+5]]; ok {
+		t.Error("key never processed is reported")
+	}
+	if seen := processedKeys(t, store, "orders"); len(seen) != 0 {
+		t.Errorf("keys found without asking: %v", seen)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	store := openTestStore(t)
+	snapshot := func() (map[string]Row, bool) {
+		t.Helper()
+		rows, found, err := store.Snapshot("orders")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows, found
+	}
+	replace := func(result []Row) {
+		t.Helper()
+		err := store.Update(func(tx *StateTx) error {
+			return tx.ReplaceSnapshot("orders", result)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, found := snapshot(); found {
+		t.Fatal("snapshot found before the first run")
+	}
+
+	replace([]Row{row("1", "status", "new"), row("2", "status", "paid")})
+	rows, found := snapshot()
+	if !found || len(rows) != 2 || rows["2"].Values["status"] != "paid" {
+		t.Fatalf("snapshot = %v, %v", rows, found)
+	}
+
+	// An empty result is a snapshot too
+	replace(nil)
+	if rows, found := snapshot(); !found || len(rows) != 0 {
+		t.Errorf("empty snapshot = %v, %v", rows, found)
+	}
+}
+
+func TestAlertIncidents(t *testing.T) {
+	store := openTestStore(t)
+	t0 := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	state := func() AlertState {
+		t.Helper()
+		var alert AlertState
+		err := store.Update(func(tx *StateTx) (err error) {
+			alert, err = tx.AlertState("orders")
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return alert
+	}
+	fire := func(at time.Time) {
+		t.Helper()
+		if err := store.Update(func(tx *StateTx) error { return tx.FireAlert("orders", at) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resolve := func(at time.Time) Incident {
+		t.Helper()
+		var incident Incident
+		err := store.Update(func(tx *StateTx) (err error) {
+			incident, err = tx.ResolveAlert("orders", at)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return incident
+	}
+
+	if alert := state(); alert.State != AlertOK || !alert.Since.IsZero() {
+		t.Fatalf("state of a new query = %+v, want ok", alert)
+	}
+
+	fire(t0)
+	if alert := state(); alert.State != AlertFiring || !alert.Since.Equal(t0) {
+		t.Errorf("state = %+v, want firing since %s", alert, t0)
+	}
+	incident := resolve(t0.Add(90 * time.Minute))
+	if !incident.StartedAt.Equal(t0) || incident.Duration() != 90*time.Minute {
+		t.Errorf("incident = %+v lasting %s, want 1h30m from %s", incident, incident.Duration(), t0)
+	}
+	if alert := state(); alert.State != AlertResolved || !alert.Since.Equal(t0.Add(90*time.Minute)) {
+		t.Errorf("state = %+v, want resolved", alert)
+	}
+
+	// The next firing period is a new incident
+	t1 := t0.Add(3 * time.Hour)
+	fire(t1)
+	if incident := resolve(t1.Add(time.Minute)); !incident.StartedAt.Equal(t1) || incident.Duration() != time.Minute {
+		t.Errorf("second incident = %+v", incident)
+	}
+
+	var open int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM incidents WHERE resolved_at IS NULL`).Scan(&open); err != nil || open != 0 {
+		t.Errorf("%d incidents left open, %v", open, err)
+	}
+	if err := store.Update(func(tx *StateTx) error { _, err := tx.ResolveAlert("orders", t1); return err }); err == nil {
+		t.Error("alert without open incident was resolved")
+	}
+}
+
+func TestAlertTargets(t *testing.T) {
+	store := openTestStore(t)
+	err := store.Update(func(tx *StateTx) error {
+		if targets, err := tx.AlertTargets("orders"); err != nil || targets != nil {
+			t.Errorf("targets of a query which never fired = %v, %v", targets, err)
+		}
+		if err := tx.SetAlertTargets("orders", []string{"query:orders", "chat"}); err != nil {
+			return err
+		}
+		if err := tx.SetAlertTargets("orders", []string{"chat"}); err != nil {
+			return err
+		}
+		targets, err := tx.AlertTargets("orders")
+		if err != nil || len(targets) != 1 || targets[0] != "chat" {
+			t.Errorf("targets = %v, %v, want the last ones", targets, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
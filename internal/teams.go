@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type teamsNotifier struct {
+	url string
+}
+
+// Adaptive Card elements are free-form, only used properties are set
+type teamsElement map[string]any
+
+type teamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     teamsElement `json:"content"`
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+// Notify posts an Adaptive Card to a Teams incoming webhook or workflow:
+// query name as title, the message, rows count, status and a table of rows.
+func (t teamsNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(teamsPayload(n))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Workflows accept the card asynchronously with 202
+	return doRequest(req, http.StatusOK, http.StatusAccepted)
+}
+
+func teamsPayload(n Notification) teamsMessage {
+	title := teamsElement{"type": "TextBlock", "text": n.Query, "weight": "Bolder", "size": "Medium", "wrap": true}
+	if n.Status == AlertFiring {
+		title["color"] = "Attention"
+	} else if n.Status == AlertResolved {
+		title["color"] = "Good"
+	}
+
+	facts := []teamsElement{{"title": "Rows", "value": fmt.Sprint(len(n.Rows))}}
+	if n.Status != "" {
+		facts = append(facts, teamsElement{"title": "Status", "value": n.Status})
+	}
+
+	body := []teamsElement{
+		title,
+		{"type": "TextBlock", "text": n.Message, "wrap": true},
+		{"type": "FactSet", "facts": facts},
+	}
+	if len(n.Rows) > 0 && len(n.Columns) > 0 {
+		body = append(body, teamsTable(n.Columns, n.Rows)...)
+	}
+
+	return teamsMessage{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: "application/vnd.microsoft.card.adaptive",
+			Content: teamsElement{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.5",
+				"body":    body,
+				"msteams": teamsElement{"width": "Full"},
+			},
+		}},
+	}
+}
+
+// teamsTable renders rows as an Adaptive Card table with column names as the header row.
+func teamsTable(columns []string, rows []map[string]string) []teamsElement {
+	shown := rows
+	if len(shown) > maxTableRows {
+		shown = shown[:maxTableRows]
+	}
+
+	row := func(cell func(column string) string) teamsElement {
+		var cells []teamsElement
+		for _, column := range columns {
+			cells = append(cells, teamsElement{
+				"type":  "TableCell",
+				"items": []teamsElement{{"type": "TextBlock", "text": cell(column), "wrap": true}},
+			})
+		}
+		return teamsElement{"type": "TableRow", "cells": cells}
+	}
+
+	var tableColumns []teamsElement
+	for range columns {
+		tableColumns = append(tableColumns, teamsElement{"width": 1})
+	}
+	tableRows := []teamsElement{row(func(column string) string { return column })}
+	for _, r := range shown {
+		tableRows = append(tableRows, row(func(column string) string { return r[column] }))
+	}
+
+	elements := []teamsElement{{
+		"type":             "Table",
+		"columns":          tableColumns,
+		"rows":             tableRows,
+		"firstRowAsHeader": true,
+	}}
+	if more := len(rows) - len(shown); more > 0 {
+		elements = append(elements, teamsElement{"type": "TextBlock", "text": fmt.Sprintf("... and %d more", more), "isSubtle": true})
+	}
+	return elements
+}
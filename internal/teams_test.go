@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// teamsCard decodes the Adaptive Card body of a posted Teams message.
+func teamsCard(t *testing.T, body string) []map[string]any {
+	t.Helper()
+	var message struct {
+		Type        string `json:"type"`
+		Attachments []struct {
+			ContentType string `json:"contentType"`
+			Content     struct {
+				Type string           `json:"type"`
+				Body []map[string]any `json:"body"`
+			} `json:"content"`
+		} `json:"attachments"`
+	}
+	if err := json.Unmarshal([]byte(body), &message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Type != "message" || len(message.Attachments) != 1 {
+		t.Fatalf("message = %+v", message)
+	}
+	attachment := message.Attachments[0]
+	if attachment.ContentType != "application/vnd.microsoft.card.adaptive" || attachment.Content.Type != "AdaptiveCard" {
+		t.Fatalf("attachment = %+v", attachment)
+	}
+	return attachment.Content.Body
+}
+
+func TestTeamsNotify(t *testing.T) {
+	server, requests := recordServer(t, http.StatusAccepted)
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierTeams, NotificationURL: server.URL + "/workflows/x"}}
+
+	tests := []struct {
+		status    string
+		wantColor any
+	}{
+		{"", nil},
+		{AlertFiring, "Attention"},
+		{AlertResolved, "Good"},
+	}
+	for i, tt := range tests {
+		n := testNotification()
+		n.Status = tt.status
+		if err := notify(t, &Config{}, query, n); err != nil {
+			t.Fatal(err)
+		}
+
+		body := teamsCard(t, requests()[i].Body)
+		if len(body) != 4 {
+			t.Fatalf("%q: got %d card elements, want title, message, facts and table", tt.status, len(body))
+		}
+		if title := body[0]; title["text"] != "orders" || title["color"] != tt.wantColor {
+			t.Errorf("%q: title = %v", tt.status, title)
+		}
+		if body[1]["text"] != n.Message {
+			t.Errorf("%q: message = %v", tt.status, body[1])
+		}
+		facts := body[2]["facts"].([]any)
+		wantFacts := 1
+		if tt.status != "" {
+			wantFacts = 2
+		}
+		if len(facts) != wantFacts || facts[0].(map[string]any)["value"] != "2" {
+			t.Errorf("%q: facts = %v", tt.status, facts)
+		}
+		if body[3]["type"] != "Table" || body[3]["firstRowAsHeader"] != true {
+			t.Errorf("%q: table = %v", tt.status, body[3])
+		}
+	}
+}
+
+func TestTeamsTable(t *testing.T) {
+	var rows []map[string]string
+	for i := 0; i < maxTableRows+3; i++ {
+		rows = append(rows, map[string]string{"id": fmt.Sprint(i), "email": fmt.Sprintf("user%d@example.com", i)})
+	}
+	data, err := json.Marshal(teamsTable([]string{"id", "email"}, rows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var elements []struct {
+		Type    string `json:"type"`
+		Text    string `json:"text"`
+		Columns []any  `json:"columns"`
+		Rows    []struct {
+			Cells []struct {
+				Items []struct {
+					Text string `json:"text"`
+				} `json:"items"`
+			} `json:"cells"`
+		} `json:"rows"`
+	}
+	if err := json.Unmarshal(data, &elements); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(elements) != 2 || elements[0].Type != "Table" || elements[1].Text != "... and 3 more" {
+		t.Fatalf("elements = %+v, want a table and the count of hidden rows", elements)
+	}
+	table := elements[0]
+	if len(table.Columns) != 2 || len(table.Rows) != maxTableRows+1 {
+		t.Fatalf("table has %d columns and %d rows, want 2 and header with %d rows", len(table.Columns), len(table.Rows), maxTableRows)
+	}
+	cell := func(row, column int) string { return table.Rows[row].Cells[column].Items[0].Text }
+	if cell(0, 0) != "id" || cell(0, 1) != "email" {
+		t.Errorf("header = %q, %q", cell(0, 0), cell(0, 1))
+	}
+	if cell(maxTableRows, 0) != fmt.Sprint(maxTableRows-1) || cell(1, 1) != "user0@example.com" {
+		t.Errorf("rows start with %q and end with %q", cell(1, 1), cell(maxTableRows, 0))
+	}
+
+	if elements := teamsTable([]string{"id"}, rows[:maxTableRows]); len(elements) != 1 {
+		t.Errorf("got %d elements for %d rows, want the table only", len(elements), maxTableRows)
+	}
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultTelegramAPIURL = "https://api.telegram.org"
+	// Bot API rejects messages longer than 4096 characters
+	telegramMessageLimit = 4096
+)
+
+var (
+	telegramEscaper     = strings.NewReplacer(markdownV2Pairs("_*[]()~`>#+-=|{}.!\\")...)
+	telegramCodeEscaper = strings.NewReplacer(markdownV2Pairs("`\\")...)
+)
+
+func markdownV2Pairs(chars string) []string {
+	var pairs []string
+	for _, c := range chars {
+		pairs = append(pairs, string(c), "\\"+string(c))
+	}
+	return pairs
+}
+
+type telegramNotifier struct {
+	apiURL string
+	token  string
+	chatID string
+}
+
+func newTelegramNotifier(config *Config, query QueryConfig) (Notifier, error) {
+	telegram := TelegramConfig{}
+	if config.Telegram != nil {
+		telegram = *config.Telegram
+	}
+
+	chatID := telegram.ChatID
+	if query.TelegramChatID != "" {
+		chatID = query.TelegramChatID
+	}
+	if telegram.BotToken == "" || chatID == "" {
+		return nil, fmt.Errorf("telegram notifier of query %s needs telegram botToken and chatId", query.Name)
+	}
+
+	apiURL := telegram.APIURL
+	if apiURL == "" {
+		apiURL = defaultTelegramAPIURL
+	}
+	return telegramNotifier{apiURL: strings.TrimRight(apiURL, "/"), token: telegram.BotToken, chatID: chatID}, nil
+}
+
+// Notify sends the message with bold query name and a row table as a code block.
+// Long messages are split into several ones, each of them is valid MarkdownV2.
+// Parts delivered by earlier attempts are skipped, so retries don't repeat them.
+func (t telegramNotifier) Notify(ctx context.Context, n Notification) error {
+	chunks := splitMessage("*"+telegramEscaper.Replace(n.Query)+"*", telegramMessageLimit, nil)
+	chunks = append(chunks, splitMessage(n.Message, telegramMessageLimit, telegramEscaper.Replace)...)
+	if len(n.Rows) > 0 && len(n.Columns) > 0 {
+		// Code block fences take 8 characters of every chunk
+		for _, chunk := range splitMessage(textTable(n.Columns, n.Rows), telegramMessageLimit-8, telegramCodeEscaper.Replace) {
+			chunks = append(chunks, "```\n"+chunk+"\n```")
+		}
+	}
+
+	// The header is short, send it together with the message when it fits
+	if len(chunks) > 1 && utf8.RuneCountInString(chunks[0])+1+utf8.RuneCountInString(chunks[1]) <= telegramMessageLimit {
+		chunks = append([]string{chunks[0] + "\n" + chunks[1]}, chunks[2:]...)
+	}
+
+	for i := n.SentParts; i < len(chunks); i++ {
+		if err := t.sendMessage(ctx, chunks[i]); err != nil {
+			if i > 0 {
+				return &PartialError{Parts: i, Err: err}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (t telegramNotifier) sendMessage(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]string{
+		"chat_id":    t.chatID,
+		"text":       text,
+		"parse_mode": "MarkdownV2",
+	})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/bot%s/sendMessage", t.apiURL, t.token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doRequest(req, http.StatusOK)
+}
+
+// splitMessage breaks text by lines into chunks that fit limit after escape,
+// lines longer than limit are cut. Escaping after the split never breaks escape sequences.
+func splitMessage(text string, limit int, escape func(string) string) []string {
+	if escape == nil {
+		escape = func(s string) string { return s }
+	}
+	fits := func(s string) bool {
+		return utf8.RuneCountInString(escape(s)) <= limit
+	}
+
+	var chunks []string
+	current := ""
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 && fits(current+"\n"+line) {
+			current += "\n" + line
+			continue
+		}
+		if i > 0 {
+			chunks = append(chunks, escape(current))
+		}
+
+		for !fits(line) {
+			runes := []rune(line)
+			n := min(len(runes), limit)
+			for n > 1 && !fits(string(runes[:n])) {
+				n--
+			}
+			chunks = append(chunks, escape(string(runes[:n])))
+			line = string(runes[n:])
+		}
+		current = line
+	}
+	if current != "" || len(chunks) == 0 {
+		chunks = append(chunks, escape(current))
+	}
+	return chunks
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	double := func(s string) string { return strings.ReplaceAll(s, "_", `\_`) }
+
+	tests := []struct {
+		name   string
+		text   string
+		limit  int
+		escape func(string) string
+		want   []string
+	}{
+		{"fits", "one\ntwo", 10, nil, []string{"one\ntwo"}},
+		{"empty", "", 10, nil, []string{""}},
+		{"by lines", "aaaa\nbbbb\ncccc", 9, nil, []string{"aaaa\nbbbb", "cccc"}},
+		{"long line is cut", "abcdefghij", 4, nil, []string{"abcd", "efgh", "ij"}},
+		{"runes not bytes", "ёёёёё", 2, nil, []string{"ёё", "ёё", "ё"}},
+		{"escaped length", "a_b_c", 6, double, []string{`a\_b\_`, "c"}},
+		{"escape not split", "__", 3, double, []string{`\_`, `\_`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitMessage(tt.text, tt.limit, tt.escape)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTelegramChunksWithinLimit(t *testing.T) {
+	text := strings.Repeat("row_with.special-chars!\n", 1000)
+	for _, chunk := range splitMessage(text, telegramMessageLimit, telegramEscaper.Replace) {
+		if n := utf8.RuneCountInString(chunk); n > telegramMessageLimit {
+			t.Fatalf("chunk of %d characters is over the limit", n)
+		}
+	}
+}
+
+func TestTelegramRetryContinuesSplitMessage(t *testing.T) {
+	var mu sync.Mutex
+	var texts []string
+	failed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]string
+		json.NewDecoder(r.Body).Decode(&message)
+		mu.Lock()
+		defer mu.Unlock()
+		// The second part fails once
+		if len(texts) == 1 && !failed {
+			failed = true
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		texts = append(texts, message["text"])
+	}))
+	defer server.Close()
+
+	config := &Config{Telegram: &TelegramConfig{BotToken: "123:ABC", ChatID: "42", APIURL: server.URL}}
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierTelegram}}
+	n := testNotification()
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	n.Message = strings.Join(lines, "\n")
+
+	deliveryErr := notify(t, config, query, n)
+	var partial *PartialError
+	if !errors.As(deliveryErr, &partial) || partial.Parts != 1 {
+		t.Fatalf("Notify() = %v, want a partial error after the first part", deliveryErr)
+	}
+
+	// The outbox remembers delivered parts for the retry
+	store := openTestStore(t)
+	entry, err := NewOutboxEntry("orders", "query:orders", n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Update(func(tx *StateTx) error { return tx.Enqueue(entry) }); err != nil {
+		t.Fatal(err)
+	}
+	entry = dueOutbox(t, store, time.Now())[0]
+	if _, err := store.DeliveryFailed(entry, deliveryErr, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	retry := dueOutbox(t, store, time.Now().Add(OutboxBaseDelay))[0]
+	if retry.Notification.SentParts != 1 {
+		t.Fatalf("stored notification has %d sent parts, want 1", retry.Notification.SentParts)
+	}
+
+	if err := notify(t, config, query, retry.Notification); err != nil {
+		t.Fatal(err)
+	}
+	if len(texts) < 3 || !strings.HasPrefix(texts[0], "*orders*") || !strings.HasPrefix(texts[len(texts)-1], "```") {
+		t.Fatalf("delivered parts %d, want the header first and the table last", len(texts))
+	}
+	seen := make(map[string]bool)
+	for i, text := range texts {
+		if seen[text] || (i > 0 && strings.HasPrefix(text, "*orders*")) {
+			t.Errorf("part %d repeats an earlier one", i)
+		}
+		seen[text] = true
+	}
+}
+
+func TestTelegramFirstPartFailure(t *testing.T) {
+	server, _ := recordServer(t, http.StatusBadGateway)
+	config := &Config{Telegram: &TelegramConfig{BotToken: "123:ABC", ChatID: "42", APIURL: server.URL}}
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierTelegram}}
+
+	err := notify(t, config, query, testNotification())
+	var partial *PartialError
+	if err == nil || errors.As(err, &partial) {
+		t.Errorf("Notify() = %v, want a plain error", err)
+	}
+}
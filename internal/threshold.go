@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Crossed reports whether value is on the alerting side of the threshold.
+func (t ThresholdConfig) Crossed(value float64) (bool, error) {
+	switch t.Operator {
+	case ">":
+		return value > t.Value, nil
+	case ">=":
+		return value >= t.Value, nil
+	case "<":
+		return value < t.Value, nil
+	case "<=":
+		return value <= t.Value, nil
+	case "==":
+		return value == t.Value, nil
+	case "!=":
+		return value != t.Value, nil
+	}
+	return false, fmt.Errorf("unknown threshold operator %q", t.Operator)
+}
+
+func (t ThresholdConfig) String() string {
+	return fmt.Sprintf("%s %s", t.Operator, strconv.FormatFloat(t.Value, 'f', -1, 64))
+}
+
+// ThresholdValue reads the single numeric result of a threshold query:
+// the first column of the first row, NULL and empty results count as zero.
+func ThresholdValue(columns []string, rows []Row) (float64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	value := strings.TrimSpace(rows[0].Values[columns[0]])
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
@@ -0,0 +1,67 @@
+package internal
+
+import "testing"
+
+func TestThresholdCrossed(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    float64
+		want     bool
+	}{
+		{">", 51, true},
+		{">", 50, false},
+		{">=", 50, true},
+		{">=", 49.9, false},
+		{"<", 49, true},
+		{"<", 50, false},
+		{"<=", 50, true},
+		{"<=", 50.1, false},
+		{"==", 50, true},
+		{"==", 51, false},
+		{"!=", 51, true},
+		{"!=", 50, false},
+	}
+	for _, tt := range tests {
+		threshold := ThresholdConfig{Operator: tt.operator, Value: 50}
+		got, err := threshold.Crossed(tt.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%v %s 50 = %v, want %v", tt.value, tt.operator, got, tt.want)
+		}
+	}
+}
+
+func TestThresholdUnknownOperator(t *testing.T) {
+	if _, err := (ThresholdConfig{Operator: "=>", Value: 1}).Crossed(2); err == nil {
+		t.Error("Crossed() with unknown operator succeeded, want error")
+	}
+}
+
+func TestThresholdValue(t *testing.T) {
+	columns := []string{"count"}
+	tests := []struct {
+		name string
+		rows []Row
+		want float64
+	}{
+		{"no rows", nil, 0},
+		{"null", []Row{{Values: map[string]string{"count": ""}}}, 0},
+		{"number", []Row{{Values: map[string]string{"count": " 42.5 "}}}, 42.5},
+		{"first row", []Row{{Values: map[string]string{"count": "1"}}, {Values: map[string]string{"count": "2"}}}, 1},
+	}
+	for _, tt := range tests {
+		got, err := ThresholdValue(columns, tt.rows)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: ThresholdValue() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := ThresholdValue(columns, []Row{{Values: map[string]string{"count": "many"}}}); err == nil {
+		t.Error("ThresholdValue() of text succeeded, want error")
+	}
+}
@@ -0,0 +1,261 @@
+package internal
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Reasons to hold notifications of a query back, shown in the summary sent when they are released.
+const (
+	HoldDigest    = "digest"
+	HoldCooldown  = "cooldown"
+	HoldRateLimit = "rate limit"
+)
+
+// Kinds of notification senders whose sends are counted by rate limits.
+const (
+	SenderQuery  = "query"
+	SenderTarget = "target"
+)
+
+// RateLimit allows Count notifications per Per.
+type RateLimit struct {
+	Count int
+	Per   time.Duration
+}
+
+// Parse validates the limit, Per is a Go duration like "1h".
+func (r RateLimitConfig) Parse() (RateLimit, error) {
+	per, err := time.ParseDuration(r.Per)
+	if err != nil {
+		return RateLimit{}, fmt.Errorf("invalid rate limit period: %w", err)
+	}
+	if r.Count <= 0 || per <= 0 {
+		return RateLimit{}, fmt.Errorf("rate limit needs positive count and period")
+	}
+	return RateLimit{Count: r.Count, Per: per}, nil
+}
+
+// Throttle is flood control of a query: a digest holds every notification for the window
+// and sends one summary, a cooldown holds notifications for a while after a sent one,
+// a rate limit holds them when too many were sent recently.
+type Throttle struct {
+	RateLimit *RateLimit
+	Cooldown  time.Duration
+	Digest    time.Duration
+}
+
+// QueryThrottle parses flood control settings of the query.
+func (c *Config) QueryThrottle(query QueryConfig) (Throttle, error) {
+	var throttle Throttle
+	var err error
+	if query.RateLimit != nil {
+		limit, err := query.RateLimit.Parse()
+		if err != nil {
+			return throttle, fmt.Errorf("query %s: %w", query.Name, err)
+		}
+		throttle.RateLimit = &limit
+	}
+	if query.Cooldown != "" {
+		if throttle.Cooldown, err = time.ParseDuration(query.Cooldown); err != nil {
+			return throttle, fmt.Errorf("invalid cooldown of query %s: %w", query.Name, err)
+		}
+	}
+	if query.Digest != "" {
+		if throttle.Digest, err = time.ParseDuration(query.Digest); err != nil || throttle.Digest <= 0 {
+			return throttle, fmt.Errorf("invalid digest window of query %s: %q", query.Name, query.Digest)
+		}
+	}
+	return throttle, nil
+}
+
+// ThrottleWindow is the longest time sends have to be remembered for rate limits and cooldowns.
+func (c *Config) ThrottleWindow() time.Duration {
+	var window time.Duration
+	for _, query := range c.Queries {
+		throttle, err := c.QueryThrottle(query)
+		if err != nil {
+			continue
+		}
+		window = max(window, throttle.Cooldown)
+		if throttle.RateLimit != nil {
+			window = max(window, throttle.RateLimit.Per)
+		}
+	}
+	for _, target := range c.Targets {
+		if target.RateLimit == nil {
+			continue
+		}
+		if limit, err := target.RateLimit.Parse(); err == nil {
+			window = max(window, limit.Per)
+		}
+	}
+	return window
+}
+
+// HeldNotifications are notifications of a query held back until ReleaseAt,
+// then they are sent as a single summary.
+type HeldNotifications struct {
+	Query         string
+	Reason        string
+	Notifications int
+	Rows          int
+	Since         time.Time
+	ReleaseAt     time.Time
+	Last          Notification
+}
+
+// Summary tells how many notifications and rows were held and repeats the last notification.
+func (h HeldNotifications) Summary(at time.Time) Notification {
+	n := h.Last
+	n.ID = ""
+	n.Message = fmt.Sprintf("%s: %d notifications with %d rows held by %s since %s, the last one:\n%s",
+		h.Query, h.Notifications, h.Rows, h.Reason, h.Since.Format(time.DateTime), h.Last.Message)
+	n.Time = at
+	return n
+}
+
+// Throttle reports whether the notification of the query may be sent now. Otherwise it is
+// added to the held ones, which are released at once when the digest window, cooldown or
+// rate limit is over. Once notifications are held, the following ones wait with them.
+func (t *StateTx) Throttle(query string, throttle Throttle, n Notification, at time.Time) (bool, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := t.tx.Exec(`UPDATE held SET notifications = notifications + 1, rows = rows + ?, last = ? WHERE query = ?`,
+		len(n.Rows), string(data), query)
+	if err != nil {
+		return false, err
+	}
+	if held, err := res.RowsAffected(); err != nil || held > 0 {
+		return false, err
+	}
+
+	var reason string
+	var releaseAt time.Time
+	if throttle.Digest > 0 {
+		reason, releaseAt = HoldDigest, at.Add(throttle.Digest)
+	}
+	if reason == "" && throttle.Cooldown > 0 {
+		last, err := lastSend(t.tx, SenderQuery, query)
+		if err != nil {
+			return false, err
+		}
+		if !last.IsZero() && at.Before(last.Add(throttle.Cooldown)) {
+			reason, releaseAt = HoldCooldown, last.Add(throttle.Cooldown)
+		}
+	}
+	if reason == "" && throttle.RateLimit != nil {
+		until, err := rateLimited(t.tx, SenderQuery, query, *throttle.RateLimit, at)
+		if err != nil {
+			return false, err
+		}
+		if !until.IsZero() {
+			reason, releaseAt = HoldRateLimit, until
+		}
+	}
+
+	if reason == "" {
+		return true, t.RecordSend(SenderQuery, query, at)
+	}
+	_, err = t.tx.Exec(`INSERT INTO held (query, reason, notifications, rows, since, release_at, last) VALUES (?, ?, 1, ?, ?, ?, ?)`,
+		query, reason, len(n.Rows), at.Unix(), releaseAt.Unix(), string(data))
+	return false, err
+}
+
+// RecordSend counts a notification of the query or to the target for rate limits and cooldowns.
+func (t *StateTx) RecordSend(kind, name string, at time.Time) error {
+	_, err := t.tx.Exec(`INSERT INTO sends (kind, name, sent_at) VALUES (?, ?, ?)`, kind, name, at.Unix())
+	return err
+}
+
+// ReleaseHeld forgets held notifications of the query, their summary counts as a sent notification.
+func (t *StateTx) ReleaseHeld(query string, at time.Time) error {
+	if _, err := t.tx.Exec(`DELETE FROM held WHERE query = ?`, query); err != nil {
+		return err
+	}
+	return t.RecordSend(SenderQuery, query, at)
+}
+
+// DueHeld returns held notifications whose summaries should be sent at the given time.
+func (s *StateStore) DueHeld(at time.Time) ([]HeldNotifications, error) {
+	rows, err := s.db.Query(`SELECT query, reason, notifications, rows, since, release_at, last FROM held
+		WHERE release_at <= ? ORDER BY release_at`, at.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var due []HeldNotifications
+	for rows.Next() {
+		var held HeldNotifications
+		var since, releaseAt int64
+		var last string
+		err := rows.Scan(&held.Query, &held.Reason, &held.Notifications, &held.Rows, &since, &releaseAt, &last)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(last), &held.Last); err != nil {
+			return nil, err
+		}
+		held.Since = time.Unix(since, 0)
+		held.ReleaseAt = time.Unix(releaseAt, 0)
+		due = append(due, held)
+	}
+	return due, rows.Err()
+}
+
+// TargetRateLimited returns when the target may get the next notification,
+// zero time when it may get one right away.
+func (s *StateStore) TargetRateLimited(target string, limit RateLimit, at time.Time) (time.Time, error) {
+	return rateLimited(s.db, SenderTarget, target, limit, at)
+}
+
+// Postpone moves the next attempt of the notification without counting it as failed.
+func (s *StateStore) Postpone(entry OutboxEntry, until time.Time) error {
+	_, err := s.db.Exec(`UPDATE outbox SET next_attempt_at = ? WHERE id = ?`, until.Unix(), entry.ID)
+	return err
+}
+
+// PruneSends forgets sends older than the given time, they no longer count for any limit.
+func (s *StateStore) PruneSends(before time.Time) (int64, error) {
+	res, err := s.db.Exec(`DELETE FROM sends WHERE sent_at < ?`, before.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// querier is either the store database or a transaction of it.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func lastSend(q querier, kind, name string) (time.Time, error) {
+	var sentAt sql.NullInt64
+	err := q.QueryRow(`SELECT MAX(sent_at) FROM sends WHERE kind = ? AND name = ?`, kind, name).Scan(&sentAt)
+	if err != nil || !sentAt.Valid {
+		return time.Time{}, err
+	}
+	return time.Unix(sentAt.Int64, 0), nil
+}
+
+// rateLimited returns when the oldest of the last limit.Count sends leaves the window,
+// zero time when fewer were sent within it.
+func rateLimited(q querier, kind, name string, limit RateLimit, at time.Time) (time.Time, error) {
+	var sentAt int64
+	err := q.QueryRow(`SELECT sent_at FROM sends WHERE kind = ? AND name = ? AND sent_at > ?
+		ORDER BY sent_at DESC LIMIT 1 OFFSET ?`, kind, name, at.Add(-limit.Per).Unix(), limit.Count-1).Scan(&sentAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(sentAt, 0).Add(limit.Per), nil
+}
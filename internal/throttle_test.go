@@ -0,0 +1,288 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func throttleTest(t *testing.T, store *StateStore, throttle Throttle, message string, at time.Time) bool {
+	t.Helper()
+	var send bool
+	err := store.Update(func(tx *StateTx) error {
+		var err error
+		send, err = tx.Throttle("orders", throttle, Notification{Query: "orders", Message: message, Rows: []map[string]string{{}}}, at)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return send
+}
+
+func releaseTest(t *testing.T, store *StateStore, at time.Time) {
+	t.Helper()
+	err := store.Update(func(tx *StateTx) error {
+		return tx.ReleaseHeld("orders", at)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func dueHeld(t *testing.T, store *StateStore, at time.Time) []HeldNotifications {
+	t.Helper()
+	due, err := store.DueHeld(at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return due
+}
+
+func checkHeld(t *testing.T, store *StateStore, releaseAt time.Time, want HeldNotifications) {
+	t.Helper()
+	if due := dueHeld(t, store, releaseAt.Add(-time.Second)); len(due) != 0 {
+		t.Fatalf("held notifications are due before %s: %+v", releaseAt, due)
+	}
+	due := dueHeld(t, store, releaseAt)
+	if len(due) != 1 {
+		t.Fatalf("got %d due held notifications, want 1", len(due))
+	}
+	got := due[0]
+	if got.Query != "orders" || got.Reason != want.Reason || got.Notifications != want.Notifications || got.Rows != want.Rows ||
+		!got.Since.Equal(want.Since) || !got.ReleaseAt.Equal(releaseAt) || got.Last.Message != want.Last.Message {
+		t.Errorf("held = %+v, want %+v released at %s", got, want, releaseAt)
+	}
+}
+
+var throttleStart = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+func TestThrottleDigest(t *testing.T) {
+	store := openTestStore(t)
+	throttle := Throttle{Digest: 10 * time.Minute, Cooldown: time.Minute}
+	t0 := throttleStart
+
+	if throttleTest(t, store, throttle, "first", t0) {
+		t.Fatal("first notification of a digest is sent")
+	}
+	if throttleTest(t, store, throttle, "second", t0.Add(time.Minute)) {
+		t.Fatal("second notification of a digest is sent")
+	}
+	checkHeld(t, store, t0.Add(10*time.Minute), HeldNotifications{
+		Reason: HoldDigest, Notifications: 2, Rows: 2, Since: t0, Last: Notification{Message: "second"},
+	})
+
+	// The next digest starts with the next notification after the release
+	releaseTest(t, store, t0.Add(10*time.Minute))
+	if due := dueHeld(t, store, t0.Add(time.Hour)); len(due) != 0 {
+		t.Fatalf("released notifications are still held: %+v", due)
+	}
+	t1 := t0.Add(20 * time.Minute)
+	if throttleTest(t, store, throttle, "third", t1) {
+		t.Fatal("notification after a digest release is sent")
+	}
+	checkHeld(t, store, t1.Add(10*time.Minute), HeldNotifications{
+		Reason: HoldDigest, Notifications: 1, Rows: 1, Since: t1, Last: Notification{Message: "third"},
+	})
+}
+
+func TestThrottleCooldown(t *testing.T) {
+	store := openTestStore(t)
+	throttle := Throttle{Cooldown: 5 * time.Minute}
+	t0 := throttleStart
+
+	if !throttleTest(t, store, throttle, "first", t0) {
+		t.Fatal("first notification is held")
+	}
+	if throttleTest(t, store, throttle, "second", t0.Add(time.Minute)) {
+		t.Fatal("notification within the cooldown is sent")
+	}
+	if throttleTest(t, store, throttle, "third", t0.Add(2*time.Minute)) {
+		t.Fatal("notification after a held one is sent")
+	}
+	checkHeld(t, store, t0.Add(5*time.Minute), HeldNotifications{
+		Reason: HoldCooldown, Notifications: 2, Rows: 2, Since: t0.Add(time.Minute), Last: Notification{Message: "third"},
+	})
+
+	// The summary starts a new cooldown
+	released := t0.Add(5 * time.Minute)
+	releaseTest(t, store, released)
+	if throttleTest(t, store, throttle, "fourth", released.Add(time.Minute)) {
+		t.Fatal("notification within the cooldown of a summary is sent")
+	}
+	checkHeld(t, store, released.Add(5*time.Minute), HeldNotifications{
+		Reason: HoldCooldown, Notifications: 1, Rows: 1, Since: released.Add(time.Minute), Last: Notification{Message: "fourth"},
+	})
+	releaseTest(t, store, released.Add(5*time.Minute))
+	if !throttleTest(t, store, throttle, "fifth", released.Add(10*time.Minute)) {
+		t.Error("notification after the cooldown is held")
+	}
+}
+
+func TestThrottleRateLimit(t *testing.T) {
+	store := openTestStore(t)
+	throttle := Throttle{RateLimit: &RateLimit{Count: 2, Per: time.Hour}}
+	t0 := throttleStart
+
+	if !throttleTest(t, store, throttle, "first", t0) || !throttleTest(t, store, throttle, "second", t0.Add(time.Minute)) {
+		t.Fatal("notification within the rate limit is held")
+	}
+	if throttleTest(t, store, throttle, "third", t0.Add(2*time.Minute)) {
+		t.Fatal("notification over the rate limit is sent")
+	}
+	// Released when the oldest send leaves the window
+	checkHeld(t, store, t0.Add(time.Hour), HeldNotifications{
+		Reason: HoldRateLimit, Notifications: 1, Rows: 1, Since: t0.Add(2 * time.Minute), Last: Notification{Message: "third"},
+	})
+
+	// The summary counts as a send: the second one and the summary fill the window again
+	releaseTest(t, store, t0.Add(time.Hour))
+	if throttleTest(t, store, throttle, "fourth", t0.Add(time.Hour+time.Second)) {
+		t.Fatal("notification over the rate limit after a summary is sent")
+	}
+	checkHeld(t, store, t0.Add(time.Hour+time.Minute), HeldNotifications{
+		Reason: HoldRateLimit, Notifications: 1, Rows: 1, Since: t0.Add(time.Hour + time.Second), Last: Notification{Message: "fourth"},
+	})
+}
+
+func TestTargetRateLimited(t *testing.T) {
+	store := openTestStore(t)
+	limit := RateLimit{Count: 2, Per: 10 * time.Minute}
+	t0 := throttleStart
+
+	rateLimited := func(target string, at time.Time) time.Time {
+		t.Helper()
+		until, err := store.TargetRateLimited(target, limit, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return until
+	}
+
+	for _, at := range []time.Time{t0, t0.Add(time.Minute)} {
+		if until := rateLimited("chat", at); !until.IsZero() {
+			t.Fatalf("target is limited until %s after fewer sends than the limit", until)
+		}
+		err := store.Update(func(tx *StateTx) error {
+			return tx.RecordSend(SenderTarget, "chat", at)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if until := rateLimited("chat", t0.Add(2*time.Minute)); !until.Equal(t0.Add(10 * time.Minute)) {
+		t.Errorf("target is limited until %s, want %s", until, t0.Add(10*time.Minute))
+	}
+	if until := rateLimited("chat", t0.Add(10*time.Minute)); !until.IsZero() {
+		t.Errorf("target is still limited until %s after the window", until)
+	}
+	if until := rateLimited("oncall", t0.Add(2*time.Minute)); !until.IsZero() {
+		t.Errorf("another target is limited until %s", until)
+	}
+
+	// Sends of queries do not count for targets of the same name
+	err := store.Update(func(tx *StateTx) error {
+		return tx.RecordSend(SenderQuery, "oncall", t0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until, _ := store.TargetRateLimited("oncall", RateLimit{Count: 1, Per: time.Hour}, t0); !until.IsZero() {
+		t.Errorf("query sends limit the target until %s", until)
+	}
+
+	if removed, err := store.PruneSends(t0.Add(time.Minute)); err != nil || removed != 2 {
+		t.Errorf("PruneSends() = %d, %v, want 2", removed, err)
+	}
+}
+
+func TestHeldSummary(t *testing.T) {
+	held := HeldNotifications{
+		Query:         "orders",
+		Reason:        HoldDigest,
+		Notifications: 3,
+		Rows:          7,
+		Since:         time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		Last:          Notification{ID: "abc", Query: "orders", Message: "orders: 2 new rows", Columns: []string{"id"}},
+	}
+	at := time.Date(2026, 10, 17, 12, 10, 0, 0, time.UTC)
+	n := held.Summary(at)
+	if n.ID != "" || !n.Time.Equal(at) || len(n.Columns) != 1 {
+		t.Errorf("summary = %+v", n)
+	}
+	want := "orders: 3 notifications with 7 rows held by digest since 2026-10-17 12:00:00, the last one:\norders: 2 new rows"
+	if n.Message != want {
+		t.Errorf("summary message = %q, want %q", n.Message, want)
+	}
+}
+
+func TestQueryThrottle(t *testing.T) {
+	config := &Config{}
+	tests := []struct {
+		name    string
+		query   QueryConfig
+		want    Throttle
+		wantErr string
+	}{
+		{"none", QueryConfig{}, Throttle{}, ""},
+		{"all", QueryConfig{RateLimit: &RateLimitConfig{Count: 3, Per: "1h"}, Cooldown: "5m", Digest: "15m"},
+			Throttle{RateLimit: &RateLimit{Count: 3, Per: time.Hour}, Cooldown: 5 * time.Minute, Digest: 15 * time.Minute}, ""},
+		{"bad rate period", QueryConfig{RateLimit: &RateLimitConfig{Count: 3, Per: "hourly"}}, Throttle{}, "invalid rate limit period"},
+		{"zero rate count", QueryConfig{RateLimit: &RateLimitConfig{Per: "1h"}}, Throttle{}, "positive count"},
+		{"bad cooldown", QueryConfig{Cooldown: "5"}, Throttle{}, "invalid cooldown"},
+		{"zero digest", QueryConfig{Digest: "0s"}, Throttle{}, "invalid digest window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Name = "orders"
+			got, err := config.QueryThrottle(tt.query)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Cooldown != tt.want.Cooldown || got.Digest != tt.want.Digest ||
+				(got.RateLimit == nil) != (tt.want.RateLimit == nil) || (got.RateLimit != nil && *got.RateLimit != *tt.want.RateLimit) {
+				t.Errorf("throttle = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThrottleWindow(t *testing.T) {
+	config := &Config{
+		Queries: []QueryConfig{
+			{Name: "orders", Cooldown: "30m", RateLimit: &RateLimitConfig{Count: 1, Per: "10m"}},
+			{Name: "broken", Cooldown: "forever"},
+		},
+		Targets: map[string]NamedTarget{"chat": {RateLimit: &RateLimitConfig{Count: 5, Per: "2h"}}},
+	}
+	if got := config.ThrottleWindow(); got != 2*time.Hour {
+		t.Errorf("ThrottleWindow() = %s, want 2h", got)
+	}
+}
+
+func TestRateLimitJSON(t *testing.T) {
+	var config Config
+	err := json.Unmarshal([]byte(`{
+		"targets": {"chat": {"notifier": "slack", "notificationUrl": "https://hooks.slack.com/x", "rateLimit": {"count": 5, "per": "1h"}}},
+		"queries": [{"name": "orders", "query": "SELECT id FROM orders", "notifier": "slack", "rateLimit": {"count": 1, "per": "10m"}}]
+	}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chat := config.Targets["chat"]
+	if chat.RateLimit == nil || *chat.RateLimit != (RateLimitConfig{Count: 5, Per: "1h"}) || chat.Notifier != NotifierSlack {
+		t.Errorf("target = %+v", chat)
+	}
+	query := config.Queries[0]
+	if query.RateLimit == nil || *query.RateLimit != (RateLimitConfig{Count: 1, Per: "10m"}) || query.Notifier != NotifierSlack {
+		t.Errorf("query = %+v", query)
+	}
+}
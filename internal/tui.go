@@ -24,6 +24,7 @@ var (
 	cursorStyle  = focusedStyle.Copy()
 	noStyle      = lipgloss.NewStyle()
 	helpStyle    = blurredStyle.Copy()
+	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color(yellowColor))
 
 	focusedButton = focusedStyle.Copy().Render("[ Submit ]")
 	blurredButton = fmt.Sprintf("[ %s ]", blurredStyle.Render("Submit"))
@@ -41,6 +42,7 @@ type model struct {
 	inputTextQuery textarea.Model
 	focusIndex     int
 	delete         bool
+	err            string
 }
 
 var filePath string
@@ -68,10 +70,10 @@ func InitialModel() model {
 	m := model{
 		selected:       nil,
 		focusIndex:     0,
-		topButtons:     []string{"⚙️  Configure settings", "🗄️  Configure database", "🆕 Create new query\n"},
+		topButtons:     []string{"⚙️  Configure settings", "🗄️  Configure databases", "🆕 Create new query\n"},
 		inputsSettings: make([]textinput.Model, 3),
-		inputsDB:       make([]textinput.Model, 5),
-		inputsQuery:    make([]textinput.Model, 3),
+		inputsDB:       make([]textinput.Model, 8),
+		inputsQuery:    make([]textinput.Model, 8),
 	}
 
 	m.SetInputs()
@@ -93,8 +95,18 @@ func (m *model) SetInputs() {
 			t.PromptStyle = focusedStyle
 			t.TextStyle = focusedStyle
 		case 1:
-			t.Placeholder = "URL"
+			t.Placeholder = "Database connection (default)"
 		case 2:
+			t.Placeholder = fmt.Sprintf("Notifier (%s)", strings.Join(NotifierNames, "/"))
+		case 3:
+			t.Placeholder = "URL"
+		case 4:
+			t.Placeholder = "Message template (empty to use base message)"
+		case 5:
+			t.Placeholder = "Interval (10s, 1h; empty to use check interval)"
+		case 6:
+			t.Placeholder = "Cron (0 9 * * 1-5; overrides interval)"
+		case 7:
 			t.Placeholder = "Disabled (y/n)"
 		}
 
@@ -112,20 +124,26 @@ func (m *model) SetInputs() {
 
 		switch i {
 		case 0:
-			t.Placeholder = "username"
+			t.Placeholder = "connection name (existing one is loaded on tab)"
 			t.Focus()
 			t.PromptStyle = focusedStyle
 			t.TextStyle = focusedStyle
 		case 1:
+			t.Placeholder = fmt.Sprintf("driver (%s)", strings.Join(DriverNames(), "/"))
+		case 2:
+			t.Placeholder = "username"
+		case 3:
 			t.Placeholder = "password"
 			t.EchoMode = textinput.EchoPassword
 			t.EchoCharacter = '•'
-		case 2:
+		case 4:
 			t.Placeholder = "host"
-		case 3:
+		case 5:
 			t.Placeholder = "port"
-		case 4:
+		case 6:
 			t.Placeholder = "name"
+		case 7:
+			t.Placeholder = "path to database file"
 		}
 
 		m.inputsDB[i] = t
@@ -143,7 +161,7 @@ func (m *model) SetInputs() {
 			t.PromptStyle = focusedStyle
 			t.TextStyle = focusedStyle
 		case 1:
-			t.Placeholder = "Notification message (must inclide one %d for rows number including)"
+			t.Placeholder = "Notification message (one %d for rows number or template like {{.Count}} new rows)"
 		case 2:
 			t.Placeholder = "Check interval in seconds"
 		}
@@ -177,6 +195,7 @@ func (m *model) handleInputsKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "ctrl+c", "esc":
 		m.selected = nil
 		m.focusIndex = 0
+		m.err = ""
 
 		return m, nil
 	case "tab", "shift+tab":
@@ -238,39 +257,33 @@ func (m model) handleConfigMenuKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 func (m model) navigateInputsQuery(s string) (tea.Model, tea.Cmd) {
 	if s == "enter" && m.focusIndex == len(m.inputsQuery)+1 {
-		var disabled bool
-		if m.inputsQuery[2].Value() == "y" {
-			disabled = true
+		queryIndex := -1
+		newQuery := m.queryFromInputs(QueryConfig{})
+		if m.selected != nil && *m.selected >= len(m.topButtons) {
+			queryIndex = *m.selected - len(m.topButtons)
+
+			// Start from the stored query to keep fields the form doesn't show
+			newQuery = m.queryFromInputs(m.config.Queries[queryIndex])
 		}
-		if m.inputsQuery[2].Value() == "n" {
-			disabled = false
+
+		// A query on an unknown connection would stop the monitor at startup, keep the form open instead
+		if _, err := m.config.QueryDatabase(newQuery); err != nil {
+			m.err = err.Error()
+			m.focusIndex = 1
+			return m.focusInputsQuery()
 		}
-		if m.selected != nil && *m.selected >= len(m.topButtons) {
-			queryIndex := *m.selected - len(m.topButtons)
 
-			newQuery := QueryConfig{
-				Name:            m.inputsQuery[0].Value(),
-				NotificationURL: m.inputsQuery[1].Value(),
-				Query:           m.inputTextQuery.Value(),
-				Disabled:        disabled,
-			}
+		if queryIndex >= 0 {
 			m.config.UpdateQuery(queryIndex, newQuery)
-			m.config.SaveToFile(filePath)
-			m.SetInputs()
 		} else {
-			newQuery := QueryConfig{
-				Name:            m.inputsQuery[0].Value(),
-				NotificationURL: m.inputsQuery[1].Value(),
-				Query:           m.inputTextQuery.Value(),
-				Disabled:        disabled,
-			}
 			m.config.AddQuery(newQuery)
-			m.config.SaveToFile(filePath)
-			m.SetInputs()
 		}
+		m.config.SaveToFile(filePath)
+		m.SetInputs()
 
 		m.selected = nil
 		m.focusIndex = 0
+		m.err = ""
 
 		return m, nil
 	}
@@ -288,6 +301,10 @@ func (m model) navigateInputsQuery(s string) (tea.Model, tea.Cmd) {
 		m.focusIndex = len(m.inputsQuery)
 	}
 
+	return m.focusInputsQuery()
+}
+
+func (m model) focusInputsQuery() (tea.Model, tea.Cmd) {
 	cmds := make([]tea.Cmd, len(m.inputsQuery))
 	for i := 0; i <= len(m.inputsQuery)-1; i++ {
 		if i == m.focusIndex {
@@ -311,16 +328,32 @@ func (m model) navigateInputsQuery(s string) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+func (m model) queryFromInputs(query QueryConfig) QueryConfig {
+	query.Name = m.inputsQuery[0].Value()
+	query.Database = strings.TrimSpace(m.inputsQuery[1].Value())
+	query.Notifier = strings.ToLower(strings.TrimSpace(m.inputsQuery[2].Value()))
+	query.NotificationURL = m.inputsQuery[3].Value()
+	query.Message = m.inputsQuery[4].Value()
+	query.Interval = strings.TrimSpace(m.inputsQuery[5].Value())
+	query.Cron = strings.TrimSpace(m.inputsQuery[6].Value())
+	query.Query = m.inputTextQuery.Value()
+
+	if m.inputsQuery[7].Value() == "y" {
+		query.Disabled = true
+	}
+	if m.inputsQuery[7].Value() == "n" {
+		query.Disabled = false
+	}
+	return query
+}
+
 func (m model) navigateInputsDB(s string) (tea.Model, tea.Cmd) {
-	if s == "enter" && m.focusIndex == len(m.inputsDB) {
-		newDB := DatabaseConfig{
-			Username: m.inputsDB[0].Value(),
-			Password: m.inputsDB[1].Value(),
-			Host:     m.inputsDB[2].Value(),
-			Port:     m.inputsDB[3].Value(),
-			Name:     m.inputsDB[4].Value(),
+	if s == "enter" && m.focusIndex == len(m.visibleInputsDB()) {
+		name := strings.TrimSpace(m.inputsDB[0].Value())
+		if name == "" {
+			name = DefaultDatabaseName
 		}
-		m.config.UpdateDB(newDB)
+		m.config.UpdateDB(name, m.dbFromInputs())
 		m.config.SaveToFile(filePath)
 		m.SetInputs()
 
@@ -330,6 +363,14 @@ func (m model) navigateInputsDB(s string) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	// Leaving the name input switches the form to that connection if it exists
+	if m.focusIndex == 0 {
+		if db, ok := m.config.Databases[strings.TrimSpace(m.inputsDB[0].Value())]; ok {
+			setInputsFromDB(db, m.inputsDB[1:])
+		}
+	}
+	visible := m.visibleInputsDB()
+
 	// Cycle indexes
 	if s == "up" || s == "shift+tab" {
 		m.focusIndex--
@@ -337,41 +378,64 @@ func (m model) navigateInputsDB(s string) (tea.Model, tea.Cmd) {
 		m.focusIndex++
 	}
 
-	if m.focusIndex > len(m.inputsDB) {
+	if m.focusIndex > len(visible) {
 		m.focusIndex = 0
 	} else if m.focusIndex < 0 {
-		m.focusIndex = len(m.inputsDB)
+		m.focusIndex = len(visible)
 	}
 
 	cmds := make([]tea.Cmd, len(m.inputsDB))
-	for i := 0; i <= len(m.inputsDB)-1; i++ {
-		if i == m.focusIndex {
-			// Set focused state
-			cmds[i] = m.inputsDB[i].Focus()
-			m.inputsDB[i].PromptStyle = focusedStyle
-			m.inputsDB[i].TextStyle = focusedStyle
-			continue
-		}
-		// Remove focused state
+	for i := range m.inputsDB {
 		m.inputsDB[i].Blur()
 		m.inputsDB[i].PromptStyle = noStyle
 		m.inputsDB[i].TextStyle = noStyle
 	}
+	if m.focusIndex < len(visible) {
+		i := visible[m.focusIndex]
+		cmds[i] = m.inputsDB[i].Focus()
+		m.inputsDB[i].PromptStyle = focusedStyle
+		m.inputsDB[i].TextStyle = focusedStyle
+	}
 
 	return m, tea.Batch(cmds...)
 }
 
+// visibleInputsDB returns indexes of database inputs relevant for the typed driver:
+// file based drivers only need a path, server based ones need credentials and address.
+func (m model) visibleInputsDB() []int {
+	db := DatabaseConfig{Driver: strings.ToLower(strings.TrimSpace(m.inputsDB[1].Value()))}
+	if db.UsesPath() {
+		return []int{0, 1, 7}
+	}
+	return []int{0, 1, 2, 3, 4, 5, 6}
+}
+
+func (m model) dbFromInputs() DatabaseConfig {
+	newDB := DatabaseConfig{
+		Driver:  strings.ToLower(strings.TrimSpace(m.inputsDB[1].Value())),
+		SSLMode: m.config.Databases[strings.TrimSpace(m.inputsDB[0].Value())].SSLMode,
+	}
+	if newDB.UsesPath() {
+		newDB.Path = m.inputsDB[7].Value()
+		return newDB
+	}
+
+	newDB.Username = m.inputsDB[2].Value()
+	newDB.Password = m.inputsDB[3].Value()
+	newDB.Host = m.inputsDB[4].Value()
+	newDB.Port = m.inputsDB[5].Value()
+	newDB.Name = m.inputsDB[6].Value()
+	return newDB
+}
+
 func (m model) navigateInputsSettings(s string) (tea.Model, tea.Cmd) {
 	if s == "enter" && m.focusIndex == len(m.inputsSettings) {
 		seconds, _ := strconv.Atoi(m.inputsSettings[2].Value())
 
-		newSettings := Config{
-			Database:             m.config.Database,
-			Queries:              m.config.Queries,
-			BaseNotificationURL:  m.inputsSettings[0].Value(),
-			NotificationMessage:  m.inputsSettings[1].Value(),
-			CheckIntervalSeconds: seconds,
-		}
+		newSettings := m.config
+		newSettings.BaseNotificationURL = m.inputsSettings[0].Value()
+		newSettings.NotificationMessage = m.inputsSettings[1].Value()
+		newSettings.CheckIntervalSeconds = seconds
 		m.config.UpdateSettings(&newSettings)
 		m.config.SaveToFile(filePath)
 		m.SetInputs()
@@ -457,7 +521,12 @@ func (m *model) toggleSelected() (tea.Model, tea.Cmd) {
 		setInputsFromSettings(&m.config, m.inputsSettings)
 	case 1:
 		m.selected = &m.cursor
-		setInputsFromDB(&m.config, m.inputsDB)
+		name := DefaultDatabaseName
+		if _, ok := m.config.Databases[name]; !ok && len(m.config.Databases) > 0 {
+			name = m.config.GetDatabaseNames()[0]
+		}
+		m.inputsDB[0].SetValue(name)
+		setInputsFromDB(m.config.Databases[name], m.inputsDB[1:])
 	case 2:
 		m.selected = &m.cursor
 		clearInputs(m.inputsQuery, &m.inputTextQuery)
@@ -484,8 +553,18 @@ func setInputsFromQuery(config *Config, inputs []textinput.Model, inputText *tex
 			case 0:
 				input.SetValue(query.Name)
 			case 1:
-				input.SetValue(query.NotificationURL)
+				input.SetValue(query.Database)
 			case 2:
+				input.SetValue(query.Notifier)
+			case 3:
+				input.SetValue(query.NotificationURL)
+			case 4:
+				input.SetValue(query.Message)
+			case 5:
+				input.SetValue(query.Interval)
+			case 6:
+				input.SetValue(query.Cron)
+			case 7:
 				if query.Disabled {
 					input.SetValue("y")
 				} else {
@@ -499,19 +578,23 @@ func setInputsFromQuery(config *Config, inputs []textinput.Model, inputText *tex
 	}
 }
 
-func setInputsFromDB(config *Config, inputs []textinput.Model) {
+func setInputsFromDB(db DatabaseConfig, inputs []textinput.Model) {
 	for i, input := range inputs {
 		switch i {
 		case 0:
-			input.SetValue(config.Database.Username)
+			input.SetValue(db.Driver)
 		case 1:
-			input.SetValue(config.Database.Password)
+			input.SetValue(db.Username)
 		case 2:
-			input.SetValue(config.Database.Host)
+			input.SetValue(db.Password)
 		case 3:
-			input.SetValue(config.Database.Port)
+			input.SetValue(db.Host)
 		case 4:
-			input.SetValue(config.Database.Name)
+			input.SetValue(db.Port)
+		case 5:
+			input.SetValue(db.Name)
+		case 6:
+			input.SetValue(db.Path)
 		}
 		inputs[i] = input
 	}
@@ -575,7 +658,11 @@ func (m model) View() string {
 	if m.shouldShowInputsView() {
 		return m.renderInputsView(m.inputsQuery, &m.inputTextQuery)
 	} else if m.shouldShowDBView() {
-		return m.renderInputsView(m.inputsDB, nil)
+		var inputs []textinput.Model
+		for _, i := range m.visibleInputsDB() {
+			inputs = append(inputs, m.inputsDB[i])
+		}
+		return m.renderInputsView(inputs, nil)
 	} else if m.shouldShowSettingsView() {
 		return m.renderInputsView(m.inputsSettings, nil)
 	} else {
@@ -599,6 +686,9 @@ func (m model) renderInputsView(inputs []textinput.Model, inputText *textarea.Mo
 	var b strings.Builder
 
 	renderInputs(&b, inputs, inputText)
+	if m.err != "" {
+		fmt.Fprintf(&b, "\n\n%s", errorStyle.Render(m.err))
+	}
 
 	inputsLen := len(inputs)
 	if inputText != nil {
@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Body of webhooks without own template
+const defaultWebhookBody = `{"query": {{json .Name}}, "message": {{json .Message}}, "status": {{json .Status}}, ` +
+	`"count": {{.Count}}, "columns": {{json .Columns}}, "rows": {{json .Rows}}, "time": {{json .Time}}}`
+
+type webhookNotifier struct {
+	url     *template.Template
+	method  *template.Template
+	headers map[string]*template.Template
+	body    *template.Template
+}
+
+func newWebhookNotifier(query QueryConfig) (Notifier, error) {
+	webhook := WebhookConfig{}
+	if query.Webhook != nil {
+		webhook = *query.Webhook
+	}
+	if webhook.Method == "" {
+		webhook.Method = http.MethodPost
+	}
+	if webhook.Body == "" {
+		webhook.Body = defaultWebhookBody
+	}
+
+	parse := func(name, text string) (*template.Template, error) {
+		return parseTemplate(query.Name, "webhook "+name, text)
+	}
+
+	var w webhookNotifier
+	var err error
+	if w.url, err = parse("url", query.NotificationURL); err != nil {
+		return nil, err
+	}
+	if w.method, err = parse("method", webhook.Method); err != nil {
+		return nil, err
+	}
+	if w.body, err = parse("body", webhook.Body); err != nil {
+		return nil, err
+	}
+
+	w.headers = make(map[string]*template.Template, len(webhook.Headers))
+	for name, value := range webhook.Headers {
+		if w.headers[name], err = parse(name+" header", value); err != nil {
+			return nil, err
+		}
+	}
+
+	// A body which isn't JSON even for sample data is a mistake of config, not of some rows
+	sample := newTemplateData(Notification{Query: query.Name, Message: "sample", Status: AlertFiring,
+		Columns: []string{"id"}, Rows: []map[string]string{{"id": "1"}}, Time: time.Now()})
+	if body, err := renderTemplate(w.body, sample); err == nil && !json.Valid([]byte(body)) {
+		return nil, fmt.Errorf("webhook body of query %s is not valid JSON: %s", query.Name, truncate(body, 200))
+	}
+	return w, nil
+}
+
+// Notify renders the request from templates and sends it, any 2xx status is a success.
+func (w webhookNotifier) Notify(ctx context.Context, n Notification) error {
+	data := newTemplateData(n)
+	render := func(tmpl *template.Template) (string, error) {
+		return renderTemplate(tmpl, data)
+	}
+
+	url, err := render(w.url)
+	if err != nil {
+		return err
+	}
+	method, err := render(w.method)
+	if err != nil {
+		return err
+	}
+	body, err := render(w.body)
+	if err != nil {
+		return err
+	}
+	if !json.Valid([]byte(body)) {
+		return &ConfigError{Err: fmt.Errorf("webhook body of query %s is not valid JSON: %s", n.Query, truncate(body, 200))}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(strings.TrimSpace(method)), strings.TrimSpace(url), bytes.NewReader([]byte(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.ID != "" {
+		req.Header.Set("Idempotency-Key", n.ID)
+	}
+
+	// Sorted for stable requests, a header may override Content-Type
+	names := make([]string, 0, len(w.headers))
+	for name := range w.headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := render(w.headers[name])
+		if err != nil {
+			return err
+		}
+		req.Header.Set(name, value)
+	}
+
+	return doRequest(req)
+}
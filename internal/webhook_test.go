@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebhookDefaultBody(t *testing.T) {
+	server, requests := recordServer(t, http.StatusNoContent)
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierWebhook, NotificationURL: server.URL + "/hook"}}
+	n := testNotification()
+	if err := notify(t, &Config{}, query, n); err != nil {
+		t.Fatal(err)
+	}
+
+	r := requests()[0]
+	if r.Method != http.MethodPost || r.Path != "/hook" {
+		t.Errorf("request %s %s, want POST /hook", r.Method, r.Path)
+	}
+	if key := r.Header.Get("Idempotency-Key"); key != n.ID {
+		t.Errorf("Idempotency-Key = %q, want %q", key, n.ID)
+	}
+
+	var body struct {
+		Query   string              `json:"query"`
+		Message string              `json:"message"`
+		Count   int                 `json:"count"`
+		Columns []string            `json:"columns"`
+		Rows    []map[string]string `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(r.Body), &body); err != nil {
+		t.Fatalf("body is not JSON: %v\n%s", err, r.Body)
+	}
+	if body.Query != "orders" || body.Message != n.Message || body.Count != 2 || len(body.Rows) != 2 || body.Rows[1]["email"] != "b@example.com" {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+func TestWebhookTemplates(t *testing.T) {
+	server, requests := recordServer(t, http.StatusAccepted)
+	query := QueryConfig{
+		Name: "orders",
+		TargetConfig: TargetConfig{
+			Notifier:        NotifierWebhook,
+			NotificationURL: server.URL + "/orders/{{.Row.id}}",
+			Webhook: &WebhookConfig{
+				Method:  "put",
+				Headers: map[string]string{"X-Count": "{{.Count}}", "Content-Type": "application/vnd.api+json"},
+				Body:    `{"text": {{json .Message}}, "first": {{json .Row.email}}}`,
+			},
+		},
+	}
+	if err := notify(t, &Config{}, query, testNotification()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := requests()[0]
+	if r.Method != http.MethodPut || r.Path != "/orders/1" {
+		t.Errorf("request %s %s, want PUT /orders/1", r.Method, r.Path)
+	}
+	if r.Header.Get("X-Count") != "2" || r.Header.Get("Content-Type") != "application/vnd.api+json" {
+		t.Errorf("headers = %v", r.Header)
+	}
+	if want := `{"text": "orders: 2 new \u003crows\u003e", "first": "a@example.com"}`; r.Body != want {
+		t.Errorf("body = %s, want %s", r.Body, want)
+	}
+}
+
+func TestWebhookInvalidBody(t *testing.T) {
+	server, requests := recordServer(t, http.StatusOK)
+	query := QueryConfig{
+		Name: "orders",
+		TargetConfig: TargetConfig{
+			Notifier:        NotifierWebhook,
+			NotificationURL: server.URL,
+			Webhook:         &WebhookConfig{Body: `{"text": "{{.Message}}"}`},
+		},
+	}
+	n := testNotification()
+	n.Message = `say "hi"`
+	var configErr *ConfigError
+	if err := notify(t, &Config{}, query, n); !errors.As(err, &configErr) {
+		t.Errorf("Notify() with invalid JSON body = %v, want a config error", err)
+	}
+	if len(requests()) != 0 {
+		t.Error("invalid body was sent")
+	}
+
+	// A body invalid for any rows is found when the notifier is built
+	query.Webhook.Body = `{"text": {{.Message}}}`
+	if _, err := NewNotifier(&Config{}, query); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("NewNotifier() with invalid JSON body = %v, want error", err)
+	}
+}
+
+func TestWebhookStatus(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusPartialContent, http.StatusNoContent} {
+		server, _ := recordServer(t, status)
+		query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierWebhook, NotificationURL: server.URL}}
+		if err := notify(t, &Config{}, query, testNotification()); err != nil {
+			t.Errorf("status %d: %v", status, err)
+		}
+	}
+	for _, status := range []int{http.StatusMultipleChoices, http.StatusBadRequest, http.StatusBadGateway} {
+		server, _ := recordServer(t, status)
+		query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierWebhook, NotificationURL: server.URL}}
+		if err := notify(t, &Config{}, query, testNotification()); err == nil {
+			t.Errorf("status %d succeeded, want error", status)
+		}
+	}
+}
+
+func TestWebhookBadTemplate(t *testing.T) {
+	query := QueryConfig{Name: "orders", TargetConfig: TargetConfig{Notifier: NotifierWebhook, NotificationURL: "http://localhost/{{.Name"}}
+	if _, err := NewNotifier(&Config{}, query); err == nil {
+		t.Error("webhook with broken URL template was built")
+	}
+}